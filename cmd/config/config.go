@@ -8,11 +8,19 @@ import (
 )
 
 type Config struct {
-	DB          DB     `json:"db"`
-	Token       Token  `json:"token"`
-	GRPC        GRPC   `json:"gRPC"`
-	Logger      Logger `json:"logger"`
-	ServiceName string `env:"SERVICE_NAME" envDefault:"auth" json:"serviceName"`
+	DB          DB       `json:"db"`
+	Token       Token    `json:"token"`
+	GRPC        GRPC     `json:"gRPC"`
+	HTTP        HTTP     `json:"http"`
+	Notifier    Notifier `json:"notifier"`
+	Password    Password `json:"password"`
+	Email       Email    `json:"email"`
+	Login       Login    `json:"login"`
+	MFA         MFA      `json:"mfa"`
+	WebAuthn    WebAuthn `json:"webAuthn"`
+	OIDC        OIDC     `json:"oidc"`
+	Logger      Logger   `json:"logger"`
+	ServiceName string   `env:"SERVICE_NAME" envDefault:"auth" json:"serviceName"`
 }
 
 type DB struct {
@@ -23,15 +31,127 @@ type DB struct {
 	Database string `env:"DB_DATABASE" json:"database"`
 }
 
+// Token configures token signing. Runtime key rotation stores the keys
+// encrypted with KeyEncryptionKey and is disabled without it. Instances
+// load keys rotated elsewhere every KeySyncInterval and a rotated key
+// signs tokens two intervals after the rotation. 0 only loads keys at
+// startup and signs with rotated keys at once, which suits a single
+// instance.
 type Token struct {
-	Secret     string        `env:"TOKEN_SECRET" json:"-"`
-	TokenTTL   time.Duration `env:"TOKEN_TTL" json:"token_ttl"`
-	RefreshTTL time.Duration `env:"REFRESH_TTL" json:"refresh_ttl"`
+	Secret           string        `env:"TOKEN_SECRET" envDefault:"" json:"-"`
+	Algorithm        string        `env:"TOKEN_ALGORITHM" envDefault:"HS256" json:"algorithm"`
+	PrivateKeyFile   string        `env:"TOKEN_PRIVATE_KEY_FILE" envDefault:"" json:"private_key_file"`
+	PreviousSecrets  []string      `env:"TOKEN_PREVIOUS_SECRETS" envDefault:"" json:"-"`
+	PreviousKeyFiles []string      `env:"TOKEN_PREVIOUS_KEY_FILES" envDefault:"" json:"previous_key_files"`
+	KeyGracePeriod   time.Duration `env:"TOKEN_KEY_GRACE_PERIOD" envDefault:"0" json:"key_grace_period"`
+	KeyEncryptionKey string        `env:"TOKEN_KEY_ENCRYPTION_KEY" envDefault:"" json:"-"`
+	KeySyncInterval  time.Duration `env:"TOKEN_KEY_SYNC_INTERVAL" envDefault:"30s" json:"key_sync_interval"`
+	Issuer           string        `env:"TOKEN_ISSUER" envDefault:"" json:"issuer"`
+	Audience         []string      `env:"TOKEN_AUDIENCE" envDefault:"" json:"audience"`
+	TokenTTL         time.Duration `env:"TOKEN_TTL" json:"token_ttl"`
+	RefreshTTL       time.Duration `env:"REFRESH_TTL" json:"refresh_ttl"`
 }
 
+// GRPC.RateLimits also limit the grants of the OAuth token endpoint: the
+// client_credentials grant shares the IssueServiceToken limit and the
+// other grants the Refresh limit.
 type GRPC struct {
-	Port    int           `env:"GRPC_PORT" json:"port"`
-	Timeout time.Duration `env:"GRPC_TIMEOUT" json:"timeout"`
+	Port            int           `env:"GRPC_PORT" json:"port"`
+	Timeout         time.Duration `env:"GRPC_TIMEOUT" json:"timeout"`
+	ForwardedHeader string        `env:"GRPC_FORWARDED_HEADER" envDefault:"" json:"forwarded_header"`
+	TrustedProxies  int           `env:"GRPC_TRUSTED_PROXIES" envDefault:"1" json:"trusted_proxies"`
+	RateLimits      []string      `env:"GRPC_RATE_LIMITS" envDefault:"Register=5/1m,Login=10/1m,Refresh=60/1m,VerifyMFA=10/1m,BeginWebAuthnLogin=10/1m,FinishWebAuthnLogin=10/1m,StartEmailLogin=5/1m,CompleteEmailLogin=10/1m,IssueServiceToken=30/1m,RequestPasswordReset=5/1m,ResendVerification=5/1m" json:"rate_limits"`
+}
+
+type HTTP struct {
+	Port    int           `env:"HTTP_PORT" envDefault:"8080" json:"port"`
+	Timeout time.Duration `env:"HTTP_TIMEOUT" envDefault:"10s" json:"timeout"`
+}
+
+type Notifier struct {
+	Type string `env:"NOTIFIER_TYPE" envDefault:"log" json:"type"`
+	File string `env:"NOTIFIER_FILE" envDefault:"" json:"file"`
+}
+
+type Password struct {
+	ResetTTL      time.Duration `env:"PASSWORD_RESET_TTL" envDefault:"1h" json:"reset_ttl"`
+	ResetURL      string        `env:"PASSWORD_RESET_URL" envDefault:"" json:"reset_url"`
+	ResetLimit    int           `env:"PASSWORD_RESET_LIMIT" envDefault:"3" json:"reset_limit"`
+	ResetWindow   time.Duration `env:"PASSWORD_RESET_WINDOW" envDefault:"1h" json:"reset_window"`
+	MinLength     int           `env:"PASSWORD_MIN_LENGTH" envDefault:"8" json:"min_length"`
+	MaxLength     int           `env:"PASSWORD_MAX_LENGTH" envDefault:"72" json:"max_length"`
+	RequireUpper  bool          `env:"PASSWORD_REQUIRE_UPPER" envDefault:"false" json:"require_upper"`
+	RequireLower  bool          `env:"PASSWORD_REQUIRE_LOWER" envDefault:"false" json:"require_lower"`
+	RequireDigit  bool          `env:"PASSWORD_REQUIRE_DIGIT" envDefault:"false" json:"require_digit"`
+	RequireSymbol bool          `env:"PASSWORD_REQUIRE_SYMBOL" envDefault:"false" json:"require_symbol"`
+	BlocklistFile string        `env:"PASSWORD_BLOCKLIST_FILE" envDefault:"" json:"blocklist_file"`
+	Hash          PasswordHash  `json:"hash"`
+}
+
+type PasswordHash struct {
+	Algorithm         string `env:"PASSWORD_HASH_ALGORITHM" envDefault:"bcrypt" json:"algorithm"`
+	BcryptCost        int    `env:"PASSWORD_BCRYPT_COST" envDefault:"10" json:"bcrypt_cost"`
+	Argon2Memory      uint32 `env:"PASSWORD_ARGON2_MEMORY" envDefault:"65536" json:"argon2_memory"`
+	Argon2Iterations  uint32 `env:"PASSWORD_ARGON2_ITERATIONS" envDefault:"3" json:"argon2_iterations"`
+	Argon2Parallelism uint8  `env:"PASSWORD_ARGON2_PARALLELISM" envDefault:"2" json:"argon2_parallelism"`
+	Argon2SaltLength  uint32 `env:"PASSWORD_ARGON2_SALT_LENGTH" envDefault:"16" json:"argon2_salt_length"`
+	Argon2KeyLength   uint32 `env:"PASSWORD_ARGON2_KEY_LENGTH" envDefault:"32" json:"argon2_key_length"`
+}
+
+// Email.LoginClaimUnverified makes an email login on an account with an
+// unverified email drop the password, second factors and sessions set
+// before, since someone else may have registered the email first. It is
+// always on with RequireVerified, where such accounts cannot log in
+// otherwise.
+type Email struct {
+	RequireVerified          bool          `env:"EMAIL_REQUIRE_VERIFIED" envDefault:"false" json:"require_verified"`
+	VerificationTTL          time.Duration `env:"EMAIL_VERIFICATION_TTL" envDefault:"24h" json:"verification_ttl"`
+	VerificationURL          string        `env:"EMAIL_VERIFICATION_URL" envDefault:"" json:"verification_url"`
+	VerificationResendLimit  int           `env:"EMAIL_VERIFICATION_RESEND_LIMIT" envDefault:"3" json:"verification_resend_limit"`
+	VerificationResendWindow time.Duration `env:"EMAIL_VERIFICATION_RESEND_WINDOW" envDefault:"1h" json:"verification_resend_window"`
+	LoginTTL                 time.Duration `env:"EMAIL_LOGIN_TTL" envDefault:"15m" json:"login_ttl"`
+	LoginURL                 string        `env:"EMAIL_LOGIN_URL" envDefault:"" json:"login_url"`
+	LoginLimit               int           `env:"EMAIL_LOGIN_LIMIT" envDefault:"5" json:"login_limit"`
+	LoginWindow              time.Duration `env:"EMAIL_LOGIN_WINDOW" envDefault:"1h" json:"login_window"`
+	LoginClaimUnverified     bool          `env:"EMAIL_LOGIN_CLAIM_UNVERIFIED" envDefault:"false" json:"login_claim_unverified"`
+}
+
+type Login struct {
+	MaxFailures   int           `env:"LOGIN_MAX_FAILURES" envDefault:"5" json:"max_failures"`
+	MaxIPFailures int           `env:"LOGIN_MAX_IP_FAILURES" envDefault:"20" json:"max_ip_failures"`
+	FailureWindow time.Duration `env:"LOGIN_FAILURE_WINDOW" envDefault:"15m" json:"failure_window"`
+	Lockout       time.Duration `env:"LOGIN_LOCKOUT" envDefault:"1m" json:"lockout"`
+	MaxLockout    time.Duration `env:"LOGIN_MAX_LOCKOUT" envDefault:"1h" json:"max_lockout"`
+}
+
+// MFA is disabled unless EncryptionKey, a base64 encoded 32 byte key,
+// is set. Issuer defaults to the service name.
+type MFA struct {
+	EncryptionKey string        `env:"MFA_ENCRYPTION_KEY" envDefault:"" json:"-"`
+	Issuer        string        `env:"MFA_ISSUER" envDefault:"" json:"issuer"`
+	ChallengeTTL  time.Duration `env:"MFA_CHALLENGE_TTL" envDefault:"5m" json:"challenge_ttl"`
+}
+
+// WebAuthn is disabled unless RPID, the domain passkeys are bound to, is
+// set. RPDisplayName defaults to the service name. DecoyKey, a base64
+// encoded key, derives the credentials offered for accounts without
+// passkeys. It is random if unset, instances behind one address should
+// share it.
+type WebAuthn struct {
+	RPID          string        `env:"WEBAUTHN_RP_ID" envDefault:"" json:"rp_id"`
+	RPDisplayName string        `env:"WEBAUTHN_RP_DISPLAY_NAME" envDefault:"" json:"rp_display_name"`
+	RPOrigins     []string      `env:"WEBAUTHN_RP_ORIGINS" envDefault:"" json:"rp_origins"`
+	SessionTTL    time.Duration `env:"WEBAUTHN_SESSION_TTL" envDefault:"5m" json:"session_ttl"`
+	DecoyKey      string        `env:"WEBAUTHN_DECOY_KEY" envDefault:"" json:"-"`
+}
+
+// OIDC serves an OpenID provider on the HTTP server. It requires
+// TOKEN_ISSUER to be the public URL of the HTTP server and an asymmetric
+// TOKEN_ALGORITHM.
+type OIDC struct {
+	Enabled  bool          `env:"OIDC_ENABLED" envDefault:"false" json:"enabled"`
+	LoginURL string        `env:"OIDC_LOGIN_URL" envDefault:"" json:"login_url"`
+	CodeTTL  time.Duration `env:"OIDC_CODE_TTL" envDefault:"1m" json:"code_ttl"`
 }
 
 type Logger struct {
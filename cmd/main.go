@@ -32,12 +32,15 @@ func main() {
 	go func() {
 		a.GRPCServer.MustRun()
 	}()
+	go func() {
+		a.HTTPServer.MustRun()
+	}()
 
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
 
 	<-stop
 
-	a.GRPCServer.Stop()
+	a.Stop()
 	l.Info().Msg("gracefully stopped")
 }
@@ -2,21 +2,39 @@ package app
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/base64"
 	"fmt"
+	"net/url"
+	"slices"
+	"time"
 
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
+	"golang.org/x/crypto/bcrypt"
 
 	"github.com/vindosVP/snauth/cmd/config"
 	"github.com/vindosVP/snauth/internal/app/grpc"
+	"github.com/vindosVP/snauth/internal/app/http"
+	"github.com/vindosVP/snauth/internal/httpserver"
 	"github.com/vindosVP/snauth/internal/jwt"
+	"github.com/vindosVP/snauth/internal/notifier"
+	"github.com/vindosVP/snauth/internal/password"
+	"github.com/vindosVP/snauth/internal/ratelimit"
+	"github.com/vindosVP/snauth/internal/revocation"
+	"github.com/vindosVP/snauth/internal/secretbox"
 	auth "github.com/vindosVP/snauth/internal/service"
 	"github.com/vindosVP/snauth/internal/storage"
 	"github.com/vindosVP/snauth/internal/storage/postgres"
 )
 
 type App struct {
-	GRPCServer *grpc.App
+	GRPCServer  *grpc.App
+	HTTPServer  *http.App
+	revocations *revocation.Broker
+	stopKeySync chan struct{}
 }
 
 func New(log zerolog.Logger, cfg *config.Config) *App {
@@ -27,12 +45,370 @@ func New(log zerolog.Logger, cfg *config.Config) *App {
 	}
 	p := postgres.New(pool)
 	us := storage.NewUserStorage(p)
-	tp := jwt.NewTokenProvider([]byte(cfg.Token.Secret), cfg.Token.TokenTTL, cfg.Token.RefreshTTL)
-	authService := auth.New(us, tp)
-	grpcApp := grpc.New(log, authService, cfg.GRPC.Port)
+	keys, err := keySet(cfg.Token)
+	if err != nil {
+		panic(fmt.Errorf("could not load token signing keys: %w", err))
+	}
+	ks, err := keyStore(cfg.Token, keys, us)
+	if err != nil {
+		panic(fmt.Errorf("could not create signing key store: %w", err))
+	}
+	stopKeySync := make(chan struct{})
+	if ks != nil {
+		if err := ks.Load(ctx); err != nil {
+			panic(fmt.Errorf("could not load stored signing keys: %w", err))
+		}
+		if cfg.Token.KeySyncInterval > 0 {
+			go syncSigningKeys(log, ks, cfg.Token.KeySyncInterval, stopKeySync)
+		}
+	}
+	tp := jwt.NewTokenProvider(keys, tokenConfig(cfg))
+	rb := revocation.NewBroker()
+	n, err := newNotifier(log, cfg.Notifier)
+	if err != nil {
+		panic(fmt.Errorf("could not create notifier: %w", err))
+	}
+	pp, err := passwordPolicy(cfg.Password)
+	if err != nil {
+		panic(fmt.Errorf("could not create password policy: %w", err))
+	}
+	ph, err := passwordHasher(cfg.Password.Hash)
+	if err != nil {
+		panic(fmt.Errorf("could not create password hasher: %w", err))
+	}
+	box, err := mfaSecretBox(cfg.MFA)
+	if err != nil {
+		panic(fmt.Errorf("could not create mfa secret box: %w", err))
+	}
+	mfaIssuer := cfg.MFA.Issuer
+	if mfaIssuer == "" {
+		mfaIssuer = cfg.ServiceName
+	}
+	rp, err := relyingParty(cfg)
+	if err != nil {
+		panic(fmt.Errorf("could not create webauthn relying party: %w", err))
+	}
+	decoyKey, err := webAuthnDecoyKey(cfg.WebAuthn)
+	if err != nil {
+		panic(fmt.Errorf("could not create webauthn decoy key: %w", err))
+	}
+	oidc, err := oidcConfig(cfg, tp)
+	if err != nil {
+		panic(fmt.Errorf("could not configure openid provider: %w", err))
+	}
+	authService := auth.New(auth.Deps{
+		Users:           us,
+		Tokens:          us,
+		LoginThrottle:   us,
+		Audit:           us,
+		Roles:           us,
+		MFA:             us,
+		WebAuthn:        us,
+		OAuth:           us,
+		ServiceAccounts: us,
+		TokenProvider:   tp,
+		Revocations:     rb,
+		Notifier:        n,
+		PasswordPolicy:  pp,
+		PasswordHasher:  ph,
+		SecretBox:       box,
+		RelyingParty:    rp,
+		KeyRotator:      keyRotator(ks),
+	}, auth.Config{
+		PasswordResetTTL:         cfg.Password.ResetTTL,
+		PasswordResetURL:         cfg.Password.ResetURL,
+		PasswordResetLimit:       cfg.Password.ResetLimit,
+		PasswordResetWindow:      cfg.Password.ResetWindow,
+		VerificationTTL:          cfg.Email.VerificationTTL,
+		VerificationURL:          cfg.Email.VerificationURL,
+		VerificationResendLimit:  cfg.Email.VerificationResendLimit,
+		VerificationResendWindow: cfg.Email.VerificationResendWindow,
+		RequireVerifiedEmail:     cfg.Email.RequireVerified,
+		LoginMaxFailures:         cfg.Login.MaxFailures,
+		LoginMaxIPFailures:       cfg.Login.MaxIPFailures,
+		LoginFailureWindow:       cfg.Login.FailureWindow,
+		LoginLockout:             cfg.Login.Lockout,
+		LoginMaxLockout:          cfg.Login.MaxLockout,
+		MFAIssuer:                mfaIssuer,
+		WebAuthnSessionTTL:       cfg.WebAuthn.SessionTTL,
+		WebAuthnDecoyKey:         decoyKey,
+		EmailLoginTTL:            cfg.Email.LoginTTL,
+		EmailLoginURL:            cfg.Email.LoginURL,
+		EmailLoginLimit:          cfg.Email.LoginLimit,
+		EmailLoginWindow:         cfg.Email.LoginWindow,
+		EmailLoginClaimsAccount:  cfg.Email.RequireVerified || cfg.Email.LoginClaimUnverified,
+		AuthorizationCodeTTL:     cfg.OIDC.CodeTTL,
+	})
+	limits, err := grpc.ParseRateLimits(cfg.GRPC.RateLimits)
+	if err != nil {
+		panic(fmt.Errorf("could not parse rate limits: %w", err))
+	}
+	// The OAuth token endpoint shares the buckets of the gRPC methods it
+	// stands in for, so serving both does not double the limits.
+	limiter := ratelimit.NewMemory()
+	grpcApp := grpc.New(log, authService, authService, cfg.GRPC.Port, cfg.GRPC.ForwardedHeader, cfg.GRPC.TrustedProxies, limiter, limits)
+	httpApp := http.New(log, authService, cfg.HTTP.Port, cfg.HTTP.Timeout, oidc, limiter, limits)
 	return &App{
-		GRPCServer: grpcApp,
+		GRPCServer:  grpcApp,
+		HTTPServer:  httpApp,
+		revocations: rb,
+		stopKeySync: stopKeySync,
+	}
+}
+
+// Stop closes the revocation subscriptions first, streaming RPCs would
+// otherwise keep the gRPC server from stopping gracefully.
+func (a *App) Stop() {
+	close(a.stopKeySync)
+	a.revocations.Close()
+	a.GRPCServer.Stop()
+	a.HTTPServer.Stop()
+}
+
+func newNotifier(log zerolog.Logger, cfg config.Notifier) (auth.Notifier, error) {
+	switch cfg.Type {
+	case "log":
+		return notifier.NewLog(log), nil
+	case "file":
+		if cfg.File == "" {
+			return nil, errors.New("NOTIFIER_FILE is required for the file notifier")
+		}
+		return notifier.NewFile(cfg.File), nil
+	}
+	return nil, fmt.Errorf("unknown notifier type %q", cfg.Type)
+}
+
+func passwordPolicy(cfg config.Password) (*password.Policy, error) {
+	if cfg.Hash.Algorithm == password.AlgBcrypt && cfg.MaxLength > password.MaxBytes {
+		return nil, fmt.Errorf("PASSWORD_MAX_LENGTH can not exceed %d bytes", password.MaxBytes)
+	}
+	if cfg.MinLength > cfg.MaxLength {
+		return nil, errors.New("PASSWORD_MIN_LENGTH can not exceed PASSWORD_MAX_LENGTH")
+	}
+	var blocklist map[string]struct{}
+	if cfg.BlocklistFile != "" {
+		var err error
+		blocklist, err = password.LoadBlocklist(cfg.BlocklistFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return password.NewPolicy(password.PolicyConfig{
+		MinLength:     cfg.MinLength,
+		MaxLength:     cfg.MaxLength,
+		RequireUpper:  cfg.RequireUpper,
+		RequireLower:  cfg.RequireLower,
+		RequireDigit:  cfg.RequireDigit,
+		RequireSymbol: cfg.RequireSymbol,
+	}, blocklist), nil
+}
+
+func passwordHasher(cfg config.PasswordHash) (auth.PasswordHasher, error) {
+	switch cfg.Algorithm {
+	case password.AlgBcrypt:
+		if cfg.BcryptCost < bcrypt.MinCost || cfg.BcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("PASSWORD_BCRYPT_COST must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		return password.Bcrypt{Cost: cfg.BcryptCost}, nil
+	case password.AlgArgon2id:
+		if cfg.Argon2Iterations == 0 || cfg.Argon2Parallelism == 0 || cfg.Argon2SaltLength == 0 || cfg.Argon2KeyLength == 0 {
+			return nil, errors.New("argon2id parameters must be positive")
+		}
+		return password.Argon2id{
+			Memory:      cfg.Argon2Memory,
+			Iterations:  cfg.Argon2Iterations,
+			Parallelism: cfg.Argon2Parallelism,
+			SaltLength:  cfg.Argon2SaltLength,
+			KeyLength:   cfg.Argon2KeyLength,
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown password hash algorithm %q", cfg.Algorithm)
+}
+
+// mfaSecretBox returns nil if no encryption key is configured, which
+// disables TOTP enrollment.
+func mfaSecretBox(cfg config.MFA) (auth.SecretBox, error) {
+	if cfg.EncryptionKey == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(cfg.EncryptionKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "MFA_ENCRYPTION_KEY is not valid base64")
+	}
+	return secretbox.New(key)
+}
+
+// relyingParty returns nil if no RP ID is configured, which disables
+// WebAuthn.
+func relyingParty(cfg *config.Config) (auth.RelyingParty, error) {
+	if cfg.WebAuthn.RPID == "" {
+		return nil, nil
+	}
+	name := cfg.WebAuthn.RPDisplayName
+	if name == "" {
+		name = cfg.ServiceName
+	}
+	origins := slices.DeleteFunc(cfg.WebAuthn.RPOrigins, func(o string) bool { return o == "" })
+	if len(origins) == 0 {
+		return nil, errors.New("WEBAUTHN_RP_ORIGINS is required when WEBAUTHN_RP_ID is set")
+	}
+	return webauthn.New(&webauthn.Config{
+		RPID:          cfg.WebAuthn.RPID,
+		RPDisplayName: name,
+		RPOrigins:     origins,
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        webauthn.TimeoutConfig{Enforce: true, Timeout: cfg.WebAuthn.SessionTTL},
+			Registration: webauthn.TimeoutConfig{Enforce: true, Timeout: cfg.WebAuthn.SessionTTL},
+		},
+	})
+}
+
+// webAuthnDecoyKey returns a random key if none is configured.
+func webAuthnDecoyKey(cfg config.WebAuthn) ([]byte, error) {
+	if cfg.DecoyKey == "" {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(cfg.DecoyKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "WEBAUTHN_DECOY_KEY is not valid base64")
+	}
+	return key, nil
+}
+
+// oidcConfig returns nil if the OpenID provider is disabled. Clients
+// compare the issuer of ID tokens with the discovery document, so the
+// token issuer has to be the URL the provider is served at.
+func oidcConfig(cfg *config.Config, tp *jwt.TokenProvider) (*httpserver.OIDCConfig, error) {
+	if !cfg.OIDC.Enabled {
+		return nil, nil
+	}
+	issuer, err := url.Parse(tp.Issuer())
+	if err != nil || (issuer.Scheme != "https" && issuer.Scheme != "http") || issuer.Host == "" {
+		return nil, errors.New("TOKEN_ISSUER must be the URL of the HTTP server when OIDC is enabled")
+	}
+	// Clients verify ID tokens with the published keys, HMAC keys can
+	// not be published without letting clients forge tokens.
+	if tp.SigningAlg() == jwt.AlgHS256 {
+		return nil, errors.New("TOKEN_ALGORITHM must be asymmetric when OIDC is enabled")
+	}
+	return &httpserver.OIDCConfig{
+		Issuer:     tp.Issuer(),
+		LoginURL:   cfg.OIDC.LoginURL,
+		SigningAlg: tp.SigningAlg(),
+	}, nil
+}
+
+// tokenConfig defaults the issuer to the service name.
+func tokenConfig(cfg *config.Config) jwt.Config {
+	issuer := cfg.Token.Issuer
+	if issuer == "" {
+		issuer = cfg.ServiceName
+	}
+	audience := slices.DeleteFunc(cfg.Token.Audience, func(a string) bool { return a == "" })
+	return jwt.Config{
+		Issuer:     issuer,
+		Audience:   audience,
+		TokenTTL:   cfg.Token.TokenTTL,
+		RefreshTTL: cfg.Token.RefreshTTL,
+		MFATTL:     cfg.MFA.ChallengeTTL,
+	}
+}
+
+func keySet(cfg config.Token) (*jwt.KeySet, error) {
+	active, err := signingKey(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var previous []*jwt.Key
+	for _, secret := range cfg.PreviousSecrets {
+		if secret != "" {
+			previous = append(previous, jwt.NewHMACKey([]byte(secret)))
+		}
+	}
+	for _, path := range cfg.PreviousKeyFiles {
+		if path == "" {
+			continue
+		}
+		k, err := jwt.LoadKey(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to load previous key %s", path)
+		}
+		previous = append(previous, k)
+	}
+	grace := cfg.KeyGracePeriod
+	if grace == 0 {
+		grace = cfg.RefreshTTL
+	}
+	return jwt.NewKeySet(active, grace, previous...), nil
+}
+
+// keyStore returns nil if no key encryption key is configured, which
+// disables runtime key rotation.
+func keyStore(cfg config.Token, keys *jwt.KeySet, s jwt.KeyStorage) (*jwt.KeyStore, error) {
+	if cfg.KeyEncryptionKey == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(cfg.KeyEncryptionKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "TOKEN_KEY_ENCRYPTION_KEY is not valid base64")
+	}
+	box, err := secretbox.New(key)
+	if err != nil {
+		return nil, err
+	}
+	// Every instance syncs at least once while a rotated key waits, even
+	// if one sync overlaps the rotation.
+	return jwt.NewKeyStore(keys, s, box, 2*cfg.KeySyncInterval), nil
+}
+
+// keyRotator keeps a nil key store a nil interface.
+func keyRotator(ks *jwt.KeyStore) auth.KeyRotator {
+	if ks == nil {
+		return nil
+	}
+	return ks
+}
+
+// syncSigningKeys loads the keys other instances rotated to until stop is
+// closed. Rotated keys only sign tokens after two sync intervals, so this
+// instance knows them before it has to verify such tokens.
+func syncSigningKeys(log zerolog.Logger, ks *jwt.KeyStore, interval time.Duration, stop <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			if err := ks.Load(context.Background()); err != nil {
+				log.Error().Stack().Err(err).Msg("failed to sync signing keys")
+			}
+		}
+	}
+}
+
+func signingKey(cfg config.Token) (*jwt.Key, error) {
+	if cfg.Algorithm == jwt.AlgHS256 {
+		if cfg.Secret == "" {
+			return nil, errors.New("TOKEN_SECRET is required for HS256")
+		}
+		return jwt.NewHMACKey([]byte(cfg.Secret)), nil
+	}
+	if cfg.PrivateKeyFile == "" {
+		return jwt.GenerateKey(cfg.Algorithm)
+	}
+	k, err := jwt.LoadKey(cfg.PrivateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if k.Alg() != cfg.Algorithm {
+		return nil, fmt.Errorf("key in %s is a %s key, %s expected", cfg.PrivateKeyFile, k.Alg(), cfg.Algorithm)
 	}
+	return k, nil
 }
 
 func postgresConn(cfg *config.Config) string {
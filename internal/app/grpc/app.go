@@ -13,6 +13,7 @@ import (
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
+	"github.com/vindosVP/snauth/internal/ratelimit"
 	"github.com/vindosVP/snauth/internal/server"
 )
 
@@ -45,7 +46,7 @@ func (a *App) Stop() {
 	a.gRPCServer.GracefulStop()
 }
 
-func New(log zerolog.Logger, a server.Auth, port int) *App {
+func New(log zerolog.Logger, a server.Auth, an Authenticator, port int, forwardedHeader string, trustedProxies int, limiter Limiter, limits map[string]ratelimit.Limit) *App {
 	loggingOpts := []logging.Option{
 		logging.WithLogOnEvents(
 			logging.PayloadReceived, logging.PayloadSent,
@@ -60,10 +61,24 @@ func New(log zerolog.Logger, a server.Auth, port int) *App {
 			return status.Errorf(codes.Internal, "internal error")
 		}),
 	}
-	gRPCServer := grpc.NewServer(grpc.ChainUnaryInterceptor(
-		recovery.UnaryServerInterceptor(recoveryOpts...),
-		logging.UnaryServerInterceptor(InterceptorLogger(log), loggingOpts...),
-	))
+	gRPCServer := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(
+			recovery.UnaryServerInterceptor(recoveryOpts...),
+			logging.UnaryServerInterceptor(InterceptorLogger(log), loggingOpts...),
+			RequestIDInterceptor(),
+			ClientIPInterceptor(forwardedHeader, trustedProxies),
+			AuthInterceptor(an),
+			RateLimitInterceptor(limiter, limits),
+		),
+		grpc.ChainStreamInterceptor(
+			recovery.StreamServerInterceptor(recoveryOpts...),
+			logging.StreamServerInterceptor(InterceptorLogger(log), loggingOpts...),
+			RequestIDStreamInterceptor(),
+			ClientIPStreamInterceptor(forwardedHeader, trustedProxies),
+			AuthStreamInterceptor(an),
+			RateLimitStreamInterceptor(limiter, limits),
+		),
+	)
 	server.Register(gRPCServer, a, log)
 	return &App{
 		l:          log,
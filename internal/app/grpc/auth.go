@@ -0,0 +1,137 @@
+package grpc
+
+import (
+	"context"
+	"strings"
+
+	middleware "github.com/grpc-ecosystem/go-grpc-middleware/v2"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	authv1 "github.com/vindosVP/snauth/gen/go"
+	"github.com/vindosVP/snauth/internal/models"
+	"github.com/vindosVP/snauth/internal/reqctx"
+	auth "github.com/vindosVP/snauth/internal/service"
+)
+
+type Authenticator interface {
+	Authenticate(ctx context.Context, accessToken string) (*reqctx.Caller, error)
+}
+
+// publicMethods lists the RPCs callable without an access token.
+var publicMethods = map[string]bool{
+	authv1.Auth_Register_FullMethodName:             true,
+	authv1.Auth_Login_FullMethodName:                true,
+	authv1.Auth_Refresh_FullMethodName:              true,
+	authv1.Auth_Introspect_FullMethodName:           true,
+	authv1.Auth_GetJWKS_FullMethodName:              true,
+	authv1.Auth_Logout_FullMethodName:               true,
+	authv1.Auth_RequestPasswordReset_FullMethodName: true,
+	authv1.Auth_ConfirmPasswordReset_FullMethodName: true,
+	authv1.Auth_VerifyEmail_FullMethodName:          true,
+	authv1.Auth_ResendVerification_FullMethodName:   true,
+	authv1.Auth_VerifyMFA_FullMethodName:            true,
+	authv1.Auth_BeginWebAuthnLogin_FullMethodName:   true,
+	authv1.Auth_FinishWebAuthnLogin_FullMethodName:  true,
+	authv1.Auth_StartEmailLogin_FullMethodName:      true,
+	authv1.Auth_CompleteEmailLogin_FullMethodName:   true,
+	authv1.Auth_IssueServiceToken_FullMethodName:    true,
+}
+
+// methodPermissions lists the permission privileged RPCs require.
+// Other non-public methods are open to every authenticated caller.
+var methodPermissions = map[string]string{
+	authv1.Auth_SetDeleted_FullMethodName:                 models.PermUsersDelete,
+	authv1.Auth_SetBanned_FullMethodName:                  models.PermUsersBan,
+	authv1.Auth_SetAdminRights_FullMethodName:             models.PermUsersAdmin,
+	authv1.Auth_RotateSigningKey_FullMethodName:           models.PermKeysRotate,
+	authv1.Auth_GetUser_FullMethodName:                    models.PermUsersRead,
+	authv1.Auth_ListUsers_FullMethodName:                  models.PermUsersRead,
+	authv1.Auth_UnlockUser_FullMethodName:                 models.PermUsersUnlock,
+	authv1.Auth_ListAuditEvents_FullMethodName:            models.PermAuditRead,
+	authv1.Auth_CreateRole_FullMethodName:                 models.PermRolesManage,
+	authv1.Auth_ListRoles_FullMethodName:                  models.PermRolesManage,
+	authv1.Auth_GrantPermission_FullMethodName:            models.PermRolesManage,
+	authv1.Auth_RevokePermission_FullMethodName:           models.PermRolesManage,
+	authv1.Auth_AssignRole_FullMethodName:                 models.PermRolesManage,
+	authv1.Auth_UnassignRole_FullMethodName:               models.PermRolesManage,
+	authv1.Auth_CreateOAuthClient_FullMethodName:          models.PermClientsManage,
+	authv1.Auth_ListOAuthClients_FullMethodName:           models.PermClientsManage,
+	authv1.Auth_DeleteOAuthClient_FullMethodName:          models.PermClientsManage,
+	authv1.Auth_CreateServiceAccount_FullMethodName:       models.PermServicesManage,
+	authv1.Auth_ListServiceAccounts_FullMethodName:        models.PermServicesManage,
+	authv1.Auth_RotateServiceAccountSecret_FullMethodName: models.PermServicesManage,
+	authv1.Auth_DisableServiceAccount_FullMethodName:      models.PermServicesManage,
+	authv1.Auth_SubscribeRevocations_FullMethodName:       models.PermRevocationsRead,
+}
+
+// AuthInterceptor authenticates the bearer access token of non-public
+// RPCs and stores the caller in the request context.
+func AuthInterceptor(an Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := authorize(ctx, an, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// AuthStreamInterceptor is the streaming counterpart of AuthInterceptor.
+func AuthStreamInterceptor(an Authenticator) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authorize(ss.Context(), an, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		wrapped := middleware.WrapServerStream(ss)
+		wrapped.WrappedContext = ctx
+		return handler(srv, wrapped)
+	}
+}
+
+func authorize(ctx context.Context, an Authenticator, method string) (context.Context, error) {
+	if publicMethods[method] {
+		return ctx, nil
+	}
+	token, err := bearerToken(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	caller, err := an.Authenticate(ctx, token)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidAccessToken) {
+			return nil, status.Error(codes.Unauthenticated, "invalid access token")
+		}
+		return nil, status.Error(codes.Internal, "failed to authenticate")
+	}
+	permission, ok := methodPermissions[method]
+	// Service accounts have no user, so they can only call RPCs guarded
+	// by a permission they were granted as scope.
+	if caller.ServiceAccount != "" && !ok {
+		return nil, status.Error(codes.PermissionDenied, "method is not available to service accounts")
+	}
+	if ok && !caller.Can(permission) {
+		return nil, status.Errorf(codes.PermissionDenied, "permission %s required", permission)
+	}
+	return reqctx.WithCaller(ctx, caller), nil
+}
+
+func bearerToken(ctx context.Context) (string, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", errors.New("no metadata")
+	}
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return "", errors.New("no authorization header")
+	}
+	scheme, token, found := strings.Cut(values[0], " ")
+	if !found || !strings.EqualFold(scheme, "bearer") || token == "" {
+		return "", errors.New("authorization header is not a bearer token")
+	}
+	return token, nil
+}
@@ -0,0 +1,60 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	middleware "github.com/grpc-ecosystem/go-grpc-middleware/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	"github.com/vindosVP/snauth/internal/reqctx"
+)
+
+// ClientIPInterceptor stores the client address in the request context.
+// If forwardedHeader is set, every one of the trustedProxies in front of
+// the server is expected to append the address it received the request
+// from to that header. The entry added by the outermost proxy, counted
+// from the right, is used over the peer address. Entries left of it are
+// sent by the client and can not be trusted.
+func ClientIPInterceptor(forwardedHeader string, trustedProxies int) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		return handler(reqctx.WithClientIP(ctx, clientIP(ctx, forwardedHeader, trustedProxies)), req)
+	}
+}
+
+// ClientIPStreamInterceptor is the streaming counterpart of ClientIPInterceptor.
+func ClientIPStreamInterceptor(forwardedHeader string, trustedProxies int) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		wrapped := middleware.WrapServerStream(ss)
+		wrapped.WrappedContext = reqctx.WithClientIP(ss.Context(), clientIP(ss.Context(), forwardedHeader, trustedProxies))
+		return handler(srv, wrapped)
+	}
+}
+
+func clientIP(ctx context.Context, forwardedHeader string, trustedProxies int) string {
+	if forwardedHeader != "" && trustedProxies > 0 {
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			// Repeated headers are one list in the order they were sent.
+			entries := strings.Split(strings.Join(md.Get(forwardedHeader), ","), ",")
+			// With fewer entries than proxies the header did not pass
+			// through all of them, so none of it can be trusted.
+			if len(entries) >= trustedProxies {
+				if ip := strings.TrimSpace(entries[len(entries)-trustedProxies]); ip != "" {
+					return ip
+				}
+			}
+		}
+	}
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
@@ -0,0 +1,108 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	authv1 "github.com/vindosVP/snauth/gen/go"
+	"github.com/vindosVP/snauth/internal/ratelimit"
+	"github.com/vindosVP/snauth/internal/reqctx"
+)
+
+// ParseRateLimits parses rules like Login=10/1m into limits keyed by the
+// full method name. Empty rules are skipped.
+func ParseRateLimits(rules []string) (map[string]ratelimit.Limit, error) {
+	methods := make(map[string]bool)
+	for _, m := range authv1.Auth_ServiceDesc.Methods {
+		methods[m.MethodName] = true
+	}
+	for _, s := range authv1.Auth_ServiceDesc.Streams {
+		methods[s.StreamName] = true
+	}
+	limits := make(map[string]ratelimit.Limit)
+	for _, rule := range rules {
+		if rule == "" {
+			continue
+		}
+		method, limit, ok := strings.Cut(rule, "=")
+		if !ok {
+			return nil, fmt.Errorf("rate limit %q is not in the method=count/period format", rule)
+		}
+		if !methods[method] {
+			return nil, fmt.Errorf("rate limit %q is set for an unknown method", rule)
+		}
+		l, err := ratelimit.ParseLimit(limit)
+		if err != nil {
+			return nil, err
+		}
+		limits[fmt.Sprintf("/%s/%s", authv1.Auth_ServiceDesc.ServiceName, method)] = l
+	}
+	return limits, nil
+}
+
+type Limiter interface {
+	Allow(key string, l ratelimit.Limit) (bool, time.Duration)
+}
+
+// RateLimitInterceptor limits the calls of every method in limits per
+// authenticated user, or per client IP for anonymous callers. It has to run
+// after AuthInterceptor to see the caller.
+func RateLimitInterceptor(l Limiter, limits map[string]ratelimit.Limit) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := rateLimit(ctx, l, limits, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// RateLimitStreamInterceptor is the streaming counterpart of RateLimitInterceptor.
+func RateLimitStreamInterceptor(l Limiter, limits map[string]ratelimit.Limit) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := rateLimit(ss.Context(), l, limits, info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+func rateLimit(ctx context.Context, l Limiter, limits map[string]ratelimit.Limit, method string) error {
+	limit, ok := limits[method]
+	if !ok {
+		return nil
+	}
+	allowed, wait := l.Allow(method+"|"+rateLimitKey(ctx), limit)
+	if allowed {
+		return nil
+	}
+	seconds := int(math.Ceil(wait.Seconds()))
+	_ = grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.Itoa(seconds)))
+	st, err := status.New(codes.ResourceExhausted, "rate limit exceeded").WithDetails(
+		&errdetails.RetryInfo{RetryDelay: durationpb.New(time.Duration(seconds) * time.Second)},
+	)
+	if err != nil {
+		return status.Error(codes.ResourceExhausted, "rate limit exceeded")
+	}
+	return st.Err()
+}
+
+func rateLimitKey(ctx context.Context) string {
+	if c, ok := reqctx.CallerFromContext(ctx); ok {
+		if c.ServiceAccount != "" {
+			return "service:" + c.ServiceAccount
+		}
+		return fmt.Sprintf("user:%d", c.Id)
+	}
+	return "ip:" + reqctx.ClientIP(ctx)
+}
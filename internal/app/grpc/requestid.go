@@ -0,0 +1,39 @@
+package grpc
+
+import (
+	"context"
+
+	middleware "github.com/grpc-ecosystem/go-grpc-middleware/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/vindosVP/snauth/internal/reqctx"
+)
+
+// RequestIDInterceptor stores the requestID metadata in the request context.
+func RequestIDInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		return handler(reqctx.WithRequestID(ctx, requestID(ctx)), req)
+	}
+}
+
+// RequestIDStreamInterceptor is the streaming counterpart of RequestIDInterceptor.
+func RequestIDStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		wrapped := middleware.WrapServerStream(ss)
+		wrapped.WrappedContext = reqctx.WithRequestID(ss.Context(), requestID(ss.Context()))
+		return handler(srv, wrapped)
+	}
+}
+
+func requestID(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	values := md.Get("requestID")
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
@@ -0,0 +1,64 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/vindosVP/snauth/internal/httpserver"
+	"github.com/vindosVP/snauth/internal/ratelimit"
+)
+
+const shutdownTimeout = 10 * time.Second
+
+type App struct {
+	l          zerolog.Logger
+	httpServer *http.Server
+	port       int
+}
+
+func (a *App) MustRun() {
+	if err := a.Run(); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) Run() error {
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", a.port))
+	if err != nil {
+		return fmt.Errorf("failed to create listener: %w", err)
+	}
+	a.l.Info().Str("addr", l.Addr().String()).Msg("http server started")
+	if err := a.httpServer.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to start server: %w", err)
+	}
+	return nil
+}
+
+func (a *App) Stop() {
+	a.l.Info().Msg("stopping http server")
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := a.httpServer.Shutdown(ctx); err != nil {
+		a.l.Error().Err(err).Msg("failed to stop http server gracefully")
+	}
+}
+
+func New(log zerolog.Logger, a httpserver.Auth, port int, timeout time.Duration, oidc *httpserver.OIDCConfig, limiter httpserver.Limiter, limits map[string]ratelimit.Limit) *App {
+	mux := http.NewServeMux()
+	httpserver.Register(mux, a, oidc, limiter, limits, log)
+	return &App{
+		l: log,
+		httpServer: &http.Server{
+			Handler:      mux,
+			ReadTimeout:  timeout,
+			WriteTimeout: timeout,
+		},
+		port: port,
+	}
+}
@@ -0,0 +1,91 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/vindosVP/snauth/internal/models"
+	"github.com/vindosVP/snauth/internal/ratelimit"
+)
+
+type Auth interface {
+	JWKS() []models.JWK
+	CheckAuthorizationRequest(ctx context.Context, clientId string, redirectURI string) error
+	Authorize(ctx context.Context, accessToken string, req models.AuthorizationRequest) (string, error)
+	ExchangeAuthorizationCode(ctx context.Context, clientId string, clientSecret string, code string, redirectURI string, codeVerifier string) (*models.OIDCTokens, error)
+	RefreshOAuthTokens(ctx context.Context, clientId string, clientSecret string, refreshToken string) (*models.TokenPair, error)
+	UserInfo(ctx context.Context, accessToken string) (*models.UserInfo, error)
+	IssueServiceToken(ctx context.Context, clientId string, clientSecret string, scope string) (*models.ServiceToken, error)
+}
+
+type Limiter interface {
+	Allow(key string, l ratelimit.Limit) (bool, time.Duration)
+}
+
+type server struct {
+	auth    Auth
+	oidc    *OIDCConfig
+	limiter Limiter
+	limits  map[string]ratelimit.Limit
+	l       zerolog.Logger
+}
+
+// Register serves the JWKS and, if oidc is set, the OpenID provider.
+// limits are keyed by the full name of the gRPC method an endpoint
+// stands in for.
+func Register(mux *http.ServeMux, auth Auth, oidc *OIDCConfig, limiter Limiter, limits map[string]ratelimit.Limit, l zerolog.Logger) {
+	s := &server{auth: auth, oidc: oidc, limiter: limiter, limits: limits, l: l}
+	mux.HandleFunc("GET "+jwksPath, s.jwks)
+	if oidc != nil {
+		s.registerOIDC(mux)
+	}
+}
+
+func (s *server) jwks(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	s.writeJSON(w, http.StatusOK, map[string][]models.JWK{"keys": s.auth.JWKS()})
+}
+
+func (s *server) writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.l.Error().Err(err).Msg("failed to write response")
+	}
+}
+
+// rateLimited takes a call of method for key, writing the Retry-After
+// header if the limit is exceeded.
+func (s *server) rateLimited(w http.ResponseWriter, method string, key string) bool {
+	limit, ok := s.limits[method]
+	if !ok {
+		return false
+	}
+	allowed, wait := s.limiter.Allow(method+"|"+key, limit)
+	if allowed {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	return true
+}
+
+// remoteIP is the address the request came from.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// subject is the sub claim of the user.
+func subject(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
@@ -0,0 +1,371 @@
+package httpserver
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	authv1 "github.com/vindosVP/snauth/gen/go"
+	"github.com/vindosVP/snauth/internal/models"
+	auth "github.com/vindosVP/snauth/internal/service"
+)
+
+const (
+	authorizePath = "/oauth2/authorize"
+	tokenPath     = "/oauth2/token"
+	userInfoPath  = "/oauth2/userinfo"
+	jwksPath      = "/.well-known/jwks.json"
+)
+
+// tokenGrantMethods maps the grants of the token endpoint to the gRPC
+// methods whose rate limits they share. Exchanging a code has no gRPC
+// counterpart and is limited like a refresh.
+var tokenGrantMethods = map[string]string{
+	"authorization_code": authv1.Auth_Refresh_FullMethodName,
+	"refresh_token":      authv1.Auth_Refresh_FullMethodName,
+	"client_credentials": authv1.Auth_IssueServiceToken_FullMethodName,
+}
+
+// OIDCConfig enables the OpenID provider. Issuer is the public URL of the
+// HTTP server, the endpoints are served below it. Users who are not
+// logged in are sent to LoginURL together with the authorization request,
+// the login page posts the request back with an access_token field once
+// the user has logged in.
+type OIDCConfig struct {
+	Issuer     string
+	LoginURL   string
+	SigningAlg string
+}
+
+type discovery struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+type userInfo struct {
+	Sub           string `json:"sub"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+}
+
+type oauthError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+func (s *server) registerOIDC(mux *http.ServeMux) {
+	mux.HandleFunc("GET /.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("GET "+authorizePath, s.authorize)
+	mux.HandleFunc("POST "+authorizePath, s.authorize)
+	mux.HandleFunc("POST "+tokenPath, s.token)
+	mux.HandleFunc("GET "+userInfoPath, s.userInfo)
+	mux.HandleFunc("POST "+userInfoPath, s.userInfo)
+}
+
+func (s *server) discovery(w http.ResponseWriter, _ *http.Request) {
+	issuer := strings.TrimSuffix(s.oidc.Issuer, "/")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	s.writeJSON(w, http.StatusOK, discovery{
+		Issuer:                            s.oidc.Issuer,
+		AuthorizationEndpoint:             issuer + authorizePath,
+		TokenEndpoint:                     issuer + tokenPath,
+		UserInfoEndpoint:                  issuer + userInfoPath,
+		JWKSURI:                           issuer + jwksPath,
+		ScopesSupported:                   auth.SupportedScopes,
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code", "refresh_token", "client_credentials"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{s.oidc.SigningAlg},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "email", "email_verified"},
+	})
+}
+
+// authorize implements the authorization code flow. Errors are only
+// redirected to the client once its redirect URI is known to be valid.
+func (s *server) authorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		s.writeOAuthError(w, http.StatusBadRequest, "invalid_request", "malformed request")
+		return
+	}
+	clientId := r.Form.Get("client_id")
+	redirectURI := r.Form.Get("redirect_uri")
+	l := s.l.With().Str("clientId", clientId).Logger()
+	err := s.auth.CheckAuthorizationRequest(r.Context(), clientId, redirectURI)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidOAuthClient) || errors.Is(err, auth.ErrInvalidRedirectURI) {
+			l.Info().Err(err).Msg("invalid authorization request")
+			s.writeOAuthError(w, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+		l.Error().Stack().Err(err).Msg("failed to check authorization request")
+		s.writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	state := r.Form.Get("state")
+	if r.Form.Get("response_type") != "code" {
+		redirectWith(w, r, redirectURI, url.Values{"error": {"unsupported_response_type"}, "state": {state}})
+		return
+	}
+	if r.Form.Get("code_challenge_method") != "S256" {
+		redirectWith(w, r, redirectURI, url.Values{
+			"error":             {"invalid_request"},
+			"error_description": {auth.ErrInvalidCodeChallenge.Error()},
+			"state":             {state},
+		})
+		return
+	}
+	token := r.PostForm.Get("access_token")
+	if t, ok := bearerToken(r); ok {
+		token = t
+	}
+	if token == "" {
+		s.requireLogin(w, r, redirectURI, state)
+		return
+	}
+	code, err := s.auth.Authorize(r.Context(), token, models.AuthorizationRequest{
+		ClientId:      clientId,
+		RedirectURI:   redirectURI,
+		Scope:         r.Form.Get("scope"),
+		Nonce:         r.Form.Get("nonce"),
+		CodeChallenge: r.Form.Get("code_challenge"),
+	})
+	if err != nil {
+		params := url.Values{"state": {state}}
+		switch {
+		case errors.Is(err, auth.ErrLoginRequired):
+			l.Info().Msg("login required")
+			s.requireLogin(w, r, redirectURI, state)
+			return
+		case errors.Is(err, auth.ErrInvalidScope):
+			l.Info().Msg("openid scope missing")
+			params.Set("error", "invalid_scope")
+			params.Set("error_description", err.Error())
+		case errors.Is(err, auth.ErrInvalidCodeChallenge):
+			l.Info().Msg("invalid code challenge")
+			params.Set("error", "invalid_request")
+			params.Set("error_description", err.Error())
+		case errors.Is(err, auth.ErrUserUnableToLogIn):
+			l.Info().Msg("user is deleted or banned")
+			params.Set("error", "access_denied")
+		default:
+			l.Error().Stack().Err(err).Msg("failed to authorize")
+			params.Set("error", "server_error")
+		}
+		redirectWith(w, r, redirectURI, params)
+		return
+	}
+	l.Info().Msg("issued authorization code")
+	redirectWith(w, r, redirectURI, url.Values{"code": {code}, "state": {state}})
+}
+
+// requireLogin sends the user to the login page with the authorization
+// request, unless the client asked not to prompt the user.
+func (s *server) requireLogin(w http.ResponseWriter, r *http.Request, redirectURI string, state string) {
+	if s.oidc.LoginURL == "" || r.Form.Get("prompt") == "none" {
+		redirectWith(w, r, redirectURI, url.Values{"error": {"login_required"}, "state": {state}})
+		return
+	}
+	params := url.Values{}
+	for k, v := range r.Form {
+		if k != "access_token" {
+			params[k] = v
+		}
+	}
+	redirectWith(w, r, s.oidc.LoginURL, params)
+}
+
+func (s *server) token(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	if err := r.ParseForm(); err != nil {
+		s.writeOAuthError(w, http.StatusBadRequest, "invalid_request", "malformed request")
+		return
+	}
+	clientId, clientSecret, basic := clientCredentials(r)
+	l := s.l.With().Str("clientId", clientId).Str("grantType", r.PostForm.Get("grant_type")).Logger()
+	if method, ok := tokenGrantMethods[r.PostForm.Get("grant_type")]; ok {
+		key := "ip:" + remoteIP(r)
+		if clientId != "" {
+			key = "client:" + clientId
+		}
+		if s.rateLimited(w, method, key) {
+			l.Info().Msg("rate limit exceeded")
+			s.writeOAuthError(w, http.StatusTooManyRequests, "temporarily_unavailable", "rate limit exceeded")
+			return
+		}
+	}
+	var (
+		resp tokenResponse
+		err  error
+	)
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		var tokens *models.OIDCTokens
+		tokens, err = s.auth.ExchangeAuthorizationCode(r.Context(), clientId, clientSecret,
+			r.PostForm.Get("code"), r.PostForm.Get("redirect_uri"), r.PostForm.Get("code_verifier"))
+		if err == nil {
+			resp = newTokenResponse(tokens.TokenPair)
+			resp.IDToken = tokens.IDToken
+			resp.Scope = tokens.Scope
+		}
+	case "refresh_token":
+		var tokens *models.TokenPair
+		tokens, err = s.auth.RefreshOAuthTokens(r.Context(), clientId, clientSecret, r.PostForm.Get("refresh_token"))
+		if err == nil {
+			resp = newTokenResponse(tokens)
+		}
+	case "client_credentials":
+		var token *models.ServiceToken
+		token, err = s.auth.IssueServiceToken(r.Context(), clientId, clientSecret, r.PostForm.Get("scope"))
+		if err == nil {
+			resp = tokenResponse{
+				AccessToken: token.AccessToken,
+				TokenType:   "Bearer",
+				ExpiresIn:   expiresIn(token.ExpiresAt),
+				Scope:       token.Scope,
+			}
+		}
+	default:
+		l.Info().Msg("unsupported grant type")
+		s.writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "")
+		return
+	}
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidOAuthClient) || errors.Is(err, auth.ErrInvalidServiceCredentials) {
+			l.Info().Msg("invalid client")
+			if basic {
+				w.Header().Set("WWW-Authenticate", `Basic realm="token"`)
+			}
+			s.writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "")
+			return
+		}
+		if errors.Is(err, auth.ErrInvalidGrant) || errors.Is(err, auth.ErrInvalidRefreshToken) ||
+			errors.Is(err, auth.ErrRefreshTokenReused) || errors.Is(err, auth.ErrUserUnableToLogIn) {
+			l.Info().Err(err).Msg("invalid grant")
+			s.writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "")
+			return
+		}
+		if errors.Is(err, auth.ErrScopeNotGranted) {
+			l.Info().Msg("scope not granted")
+			s.writeOAuthError(w, http.StatusBadRequest, "invalid_scope", err.Error())
+			return
+		}
+		if errors.Is(err, auth.ErrSecretJustRotated) {
+			l.Info().Msg("secret was just rotated")
+			w.Header().Set("Retry-After", "1")
+			s.writeOAuthError(w, http.StatusServiceUnavailable, "temporarily_unavailable", err.Error())
+			return
+		}
+		l.Error().Stack().Err(err).Msg("failed to issue tokens")
+		s.writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	l.Info().Msg("issued tokens")
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *server) userInfo(w http.ResponseWriter, r *http.Request) {
+	token, ok := bearerToken(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	ui, err := s.auth.UserInfo(r.Context(), token)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidAccessToken) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		s.l.Error().Stack().Err(err).Msg("failed to get user info")
+		s.writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	resp := userInfo{Sub: subject(ui.UserId)}
+	if ui.Email != "" {
+		resp.Email = ui.Email
+		resp.EmailVerified = &ui.EmailVerified
+	}
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *server) writeOAuthError(w http.ResponseWriter, code int, e string, description string) {
+	s.writeJSON(w, code, oauthError{Error: e, ErrorDescription: description})
+}
+
+func newTokenResponse(tp *models.TokenPair) tokenResponse {
+	return tokenResponse{
+		AccessToken:  tp.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    expiresIn(tp.AccessExpiresAt),
+		RefreshToken: tp.RefreshToken,
+	}
+}
+
+func expiresIn(t time.Time) int64 {
+	return int64(time.Until(t).Round(time.Second).Seconds())
+}
+
+// redirectWith adds the params to the query of the target and redirects
+// there.
+func redirectWith(w http.ResponseWriter, r *http.Request, target string, params url.Values) {
+	u, err := url.Parse(target)
+	if err != nil {
+		http.Error(w, "invalid redirect target", http.StatusInternalServerError)
+		return
+	}
+	q := u.Query()
+	for k, v := range params {
+		if len(v) > 0 && v[0] != "" {
+			q[k] = v
+		}
+	}
+	u.RawQuery = q.Encode()
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+// clientCredentials reads client_secret_basic credentials, falling back
+// to client_secret_post and to public clients sending only client_id.
+func clientCredentials(r *http.Request) (string, string, bool) {
+	if id, secret, ok := r.BasicAuth(); ok {
+		uid, err1 := url.QueryUnescape(id)
+		usecret, err2 := url.QueryUnescape(secret)
+		if err1 == nil && err2 == nil {
+			return uid, usecret, true
+		}
+	}
+	return r.PostForm.Get("client_id"), r.PostForm.Get("client_secret"), false
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "bearer") || token == "" {
+		return "", false
+	}
+	return token, true
+}
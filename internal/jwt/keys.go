@@ -0,0 +1,210 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pkg/errors"
+
+	"github.com/vindosVP/snauth/internal/models"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+)
+
+const (
+	rsaKeyBits    = 2048
+	hmacKeyLength = 32
+)
+
+// Key is a token signing key identified by its kid.
+type Key struct {
+	Id        string
+	method    jwt.SigningMethod
+	signKey   crypto.PrivateKey
+	verifyKey crypto.PublicKey
+}
+
+func NewHMACKey(secret []byte) *Key {
+	sum := sha256.Sum256(secret)
+	return &Key{
+		Id:        base64.RawURLEncoding.EncodeToString(sum[:12]),
+		method:    jwt.SigningMethodHS256,
+		signKey:   secret,
+		verifyKey: secret,
+	}
+}
+
+func (k *Key) Alg() string {
+	return k.method.Alg()
+}
+
+// GenerateKey creates a new random key for the algorithm.
+func GenerateKey(alg string) (*Key, error) {
+	var pk crypto.PrivateKey
+	var err error
+	switch alg {
+	case AlgHS256:
+		secret := make([]byte, hmacKeyLength)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, errors.Wrap(err, "failed to generate key")
+		}
+		return NewHMACKey(secret), nil
+	case AlgRS256:
+		pk, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case AlgES256:
+		pk, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgEdDSA:
+		_, pk, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate key")
+	}
+	return newAsymmetricKey(pk)
+}
+
+// ParseKey restores a key of the algorithm from the bytes MarshalPrivate
+// returned.
+func ParseKey(alg string, data []byte) (*Key, error) {
+	if alg == AlgHS256 {
+		return NewHMACKey(data), nil
+	}
+	pk, err := parsePrivateKey(data)
+	if err != nil {
+		return nil, err
+	}
+	k, err := newAsymmetricKey(pk)
+	if err != nil {
+		return nil, err
+	}
+	if k.Alg() != alg {
+		return nil, fmt.Errorf("key is a %s key, %s expected", k.Alg(), alg)
+	}
+	return k, nil
+}
+
+// MarshalPrivate returns the secret of HMAC keys and the PKCS#8 encoding
+// of asymmetric keys.
+func (k *Key) MarshalPrivate() ([]byte, error) {
+	if secret, ok := k.signKey.([]byte); ok {
+		return secret, nil
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(k.signKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal private key")
+	}
+	return der, nil
+}
+
+// LoadKey reads a PEM encoded private key. The algorithm is derived from
+// the key type. PKCS#8, PKCS#1 (RSA) and SEC 1 (EC) encodings are supported.
+func LoadKey(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read key file")
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("key file does not contain a PEM block")
+	}
+	pk, err := parsePrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	return newAsymmetricKey(pk)
+}
+
+func parsePrivateKey(der []byte) (crypto.PrivateKey, error) {
+	if pk, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return pk, nil
+	}
+	if pk, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return pk, nil
+	}
+	if pk, err := x509.ParseECPrivateKey(der); err == nil {
+		return pk, nil
+	}
+	return nil, errors.New("unsupported private key encoding")
+}
+
+func newAsymmetricKey(pk crypto.PrivateKey) (*Key, error) {
+	k := &Key{signKey: pk}
+	switch key := pk.(type) {
+	case *rsa.PrivateKey:
+		k.method = jwt.SigningMethodRS256
+		k.verifyKey = &key.PublicKey
+	case *ecdsa.PrivateKey:
+		if key.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("EC keys on curve %s are not supported", key.Curve.Params().Name)
+		}
+		k.method = jwt.SigningMethodES256
+		k.verifyKey = &key.PublicKey
+	case ed25519.PrivateKey:
+		k.method = jwt.SigningMethodEdDSA
+		k.verifyKey = key.Public()
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", pk)
+	}
+	jwk, _ := k.JWK()
+	k.Id = thumbprint(jwk)
+	return k, nil
+}
+
+// JWK returns the public part of the key.
+// Symmetric keys are never published, so ok is false for them.
+func (k *Key) JWK() (jwk models.JWK, ok bool) {
+	enc := base64.RawURLEncoding
+	jwk = models.JWK{Kid: k.Id, Use: "sig", Alg: k.method.Alg()}
+	switch key := k.verifyKey.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = enc.EncodeToString(key.N.Bytes())
+		jwk.E = enc.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = key.Curve.Params().Name
+		jwk.X = enc.EncodeToString(key.X.FillBytes(make([]byte, size)))
+		jwk.Y = enc.EncodeToString(key.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = enc.EncodeToString(key)
+	default:
+		return models.JWK{}, false
+	}
+	return jwk, true
+}
+
+// thumbprint computes the RFC 7638 JWK thumbprint.
+func thumbprint(jwk models.JWK) string {
+	var canonical string
+	switch jwk.Kty {
+	case "RSA":
+		canonical = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, jwk.E, jwk.N)
+	case "EC":
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":"EC","x":%q,"y":%q}`, jwk.Crv, jwk.X, jwk.Y)
+	case "OKP":
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":"OKP","x":%q}`, jwk.Crv, jwk.X)
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,172 @@
+package jwt
+
+import (
+	"sync"
+	"time"
+)
+
+// KeySet holds the active signing key and the retired keys that are still
+// accepted for verification until their grace period runs out. A pending
+// key verifies tokens before it becomes the active key.
+type KeySet struct {
+	mu      sync.RWMutex
+	active  *Key
+	pending *pendingKey
+	retired []retiredKey
+	grace   time.Duration
+}
+
+type retiredKey struct {
+	key       *Key
+	retiredAt time.Time
+}
+
+type pendingKey struct {
+	key         *Key
+	activatesAt time.Time
+}
+
+// NewKeySet creates a key set signing with active. The verifyOnly keys are
+// treated as retired at the moment the set is created.
+func NewKeySet(active *Key, grace time.Duration, verifyOnly ...*Key) *KeySet {
+	ks := &KeySet{active: active, grace: grace}
+	now := time.Now()
+	for _, k := range verifyOnly {
+		ks.retired = append(ks.retired, retiredKey{key: k, retiredAt: now})
+	}
+	return ks
+}
+
+func (ks *KeySet) Active() *Key {
+	ks.activate(time.Now())
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.active
+}
+
+// Lookup returns the key with the given kid if it may verify tokens.
+func (ks *KeySet) Lookup(kid string) (*Key, bool) {
+	now := time.Now()
+	ks.activate(now)
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	if ks.active.Id == kid {
+		return ks.active, true
+	}
+	if ks.pending != nil && ks.pending.key.Id == kid {
+		return ks.pending.key, true
+	}
+	for _, r := range ks.retired {
+		if r.key.Id == kid && ks.usable(r, now) {
+			return r.key, true
+		}
+	}
+	return nil, false
+}
+
+// Keys returns the active key followed by the pending key and every
+// retired key still in its grace period.
+func (ks *KeySet) Keys() []*Key {
+	now := time.Now()
+	ks.activate(now)
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	keys := []*Key{ks.active}
+	if ks.pending != nil {
+		keys = append(keys, ks.pending.key)
+	}
+	for _, r := range ks.retired {
+		if ks.usable(r, now) {
+			keys = append(keys, r.key)
+		}
+	}
+	return keys
+}
+
+// Rotate makes next the active key. The previous active key stays
+// available for verification for the grace period.
+func (ks *KeySet) Rotate(next *Key) {
+	ks.RotateAt(next, time.Now())
+}
+
+// RotateAt is Rotate for a rotation that happened at the given time.
+func (ks *KeySet) RotateAt(next *Key, at time.Time) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.rotate(next, at)
+}
+
+// Schedule makes next the active key at the given time. Until then it
+// only verifies tokens, so verifiers can learn it before it signs any.
+func (ks *KeySet) Schedule(next *Key, at time.Time) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if ks.active.Id == next.Id {
+		return
+	}
+	if !at.After(time.Now()) {
+		ks.rotate(next, at)
+		return
+	}
+	ks.pending = &pendingKey{key: next, activatesAt: at}
+}
+
+// Pending reports whether a key is waiting to become active.
+func (ks *KeySet) Pending() bool {
+	ks.activate(time.Now())
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.pending != nil
+}
+
+// activate makes the pending key active once it is due.
+func (ks *KeySet) activate(now time.Time) {
+	ks.mu.RLock()
+	due := ks.pending != nil && !now.Before(ks.pending.activatesAt)
+	ks.mu.RUnlock()
+	if !due {
+		return
+	}
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if ks.pending != nil && !now.Before(ks.pending.activatesAt) {
+		ks.rotate(ks.pending.key, ks.pending.activatesAt)
+	}
+}
+
+// rotate makes next the active key, ks.mu has to be held.
+func (ks *KeySet) rotate(next *Key, at time.Time) {
+	now := time.Now()
+	retired := []retiredKey{{key: ks.active, retiredAt: at}}
+	for _, r := range ks.retired {
+		if ks.usable(r, now) && r.key.Id != next.Id {
+			retired = append(retired, r)
+		}
+	}
+	ks.active = next
+	ks.retired = retired
+	if ks.pending != nil && ks.pending.key.Id == next.Id {
+		ks.pending = nil
+	}
+}
+
+// Retire adds a key retired at the given time, unless the set already
+// knows it or its grace period is over.
+func (ks *KeySet) Retire(k *Key, retiredAt time.Time) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	r := retiredKey{key: k, retiredAt: retiredAt}
+	if ks.active.Id == k.Id || (ks.pending != nil && ks.pending.key.Id == k.Id) || !ks.usable(r, time.Now()) {
+		return
+	}
+	for _, r := range ks.retired {
+		if r.key.Id == k.Id {
+			return
+		}
+	}
+	ks.retired = append(ks.retired, r)
+}
+
+func (ks *KeySet) usable(r retiredKey, now time.Time) bool {
+	return now.Before(r.retiredAt.Add(ks.grace))
+}
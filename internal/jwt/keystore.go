@@ -0,0 +1,103 @@
+package jwt
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/vindosVP/snauth/internal/models"
+)
+
+type KeyStorage interface {
+	SaveSigningKey(ctx context.Context, k *models.SigningKey) error
+	SigningKeys(ctx context.Context) ([]*models.SigningKey, error)
+}
+
+type Sealer interface {
+	Seal(plaintext []byte) ([]byte, error)
+	Open(sealed []byte) ([]byte, error)
+}
+
+// KeyStore persists rotated signing keys encrypted, so every instance
+// signs with the same key and rotations survive restarts. Instances pick
+// up keys rotated elsewhere with Load. A rotated key only verifies tokens
+// for activationDelay before it signs them, so every instance loads it
+// before it sees tokens signed with it.
+type KeyStore struct {
+	keys            *KeySet
+	storage         KeyStorage
+	box             Sealer
+	activationDelay time.Duration
+}
+
+func NewKeyStore(keys *KeySet, storage KeyStorage, box Sealer, activationDelay time.Duration) *KeyStore {
+	return &KeyStore{keys: keys, storage: storage, box: box, activationDelay: activationDelay}
+}
+
+// Rotate generates a key of the algorithm of the active key and stores it
+// as the key that becomes active after the activation delay.
+func (s *KeyStore) Rotate(ctx context.Context) (string, error) {
+	next, err := GenerateKey(s.keys.Active().Alg())
+	if err != nil {
+		return "", errors.Wrap(err, "failed to generate signing key")
+	}
+	private, err := next.MarshalPrivate()
+	if err != nil {
+		return "", err
+	}
+	sealed, err := s.box.Seal(private)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to encrypt signing key")
+	}
+	sk := &models.SigningKey{
+		Id:          next.Id,
+		Algorithm:   next.Alg(),
+		PrivateKey:  sealed,
+		ActivatesAt: time.Now().Add(s.activationDelay),
+	}
+	err = s.storage.SaveSigningKey(ctx, sk)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to save signing key")
+	}
+	s.keys.Schedule(next, sk.ActivatesAt)
+	return next.Id, nil
+}
+
+// Load adds the stored keys to the key set. The stored active key
+// replaces the configured one, which counts as retired when the stored
+// key became active.
+func (s *KeyStore) Load(ctx context.Context) error {
+	stored, err := s.storage.SigningKeys(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to get signing keys")
+	}
+	now := time.Now()
+	for _, sk := range stored {
+		k, err := s.open(sk)
+		if err != nil {
+			return err
+		}
+		switch {
+		case sk.ActivatesAt.After(now):
+			s.keys.Schedule(k, sk.ActivatesAt)
+		case sk.RetiredAt != nil && !sk.RetiredAt.After(now):
+			s.keys.Retire(k, *sk.RetiredAt)
+		case s.keys.Active().Id != k.Id:
+			s.keys.RotateAt(k, sk.ActivatesAt)
+		}
+	}
+	return nil
+}
+
+func (s *KeyStore) open(sk *models.SigningKey) (*Key, error) {
+	private, err := s.box.Open(sk.PrivateKey)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decrypt signing key %s", sk.Id)
+	}
+	k, err := ParseKey(sk.Algorithm, private)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse signing key %s", sk.Id)
+	}
+	return k, nil
+}
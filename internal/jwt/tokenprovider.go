@@ -1,6 +1,11 @@
 package jwt
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -9,86 +14,344 @@ import (
 	"github.com/vindosVP/snauth/internal/models"
 )
 
+const (
+	TokenUseAccess      = "access"
+	TokenUseOAuthAccess = "oauth_access"
+	TokenUseRefresh     = "refresh"
+	TokenUseMFA         = "mfa"
+)
+
+// ServiceSubjectPrefix starts the sub claim of service account tokens,
+// followed by the client id of the account.
+const ServiceSubjectPrefix = "service:"
+
+type Config struct {
+	Issuer     string
+	Audience   []string
+	TokenTTL   time.Duration
+	RefreshTTL time.Duration
+	MFATTL     time.Duration
+}
+
 type TokenProvider struct {
-	serviceName string
-	secret      []byte
-	tokenTTL    time.Duration
-	refreshTTL  time.Duration
+	issuer     string
+	audience   []string
+	keys       *KeySet
+	tokenTTL   time.Duration
+	refreshTTL time.Duration
+	mfaTTL     time.Duration
 }
 
-func NewTokenProvider(secret []byte, tokenTTL, refreshTTL time.Duration) *TokenProvider {
-	return &TokenProvider{secret: secret, tokenTTL: tokenTTL, refreshTTL: refreshTTL}
+func NewTokenProvider(keys *KeySet, cfg Config) *TokenProvider {
+	return &TokenProvider{
+		issuer:     cfg.Issuer,
+		audience:   cfg.Audience,
+		keys:       keys,
+		tokenTTL:   cfg.TokenTTL,
+		refreshTTL: cfg.RefreshTTL,
+		mfaTTL:     cfg.MFATTL,
+	}
 }
 
-func (p *TokenProvider) ParseRefresh(refreshToken string) (int64, error) {
+// JWKS returns the public keys verifiers can use to check tokens.
+func (p *TokenProvider) JWKS() []models.JWK {
+	jwks := make([]models.JWK, 0)
+	for _, k := range p.keys.Keys() {
+		if jwk, ok := k.JWK(); ok {
+			jwks = append(jwks, jwk)
+		}
+	}
+	return jwks
+}
+
+func (p *TokenProvider) ParseRefresh(refreshToken string) (*Claims, error) {
+	return p.parse(refreshToken, TokenUseRefresh)
+}
+
+func (p *TokenProvider) ParseAccess(accessToken string) (*Claims, error) {
+	return p.parse(accessToken, TokenUseAccess)
+}
+
+// ParseOAuthAccess parses access tokens issued to OAuth clients, which
+// are not accepted by the API.
+func (p *TokenProvider) ParseOAuthAccess(accessToken string) (*Claims, error) {
+	return p.parse(accessToken, TokenUseOAuthAccess)
+}
+
+func (p *TokenProvider) ParseMFA(mfaToken string) (*Claims, error) {
+	return p.parse(mfaToken, TokenUseMFA)
+}
+
+// NewMFAToken issues the token a user who passed the password check
+// presents together with the second factor.
+func (p *TokenProvider) NewMFAToken(id int64) (string, error) {
+	registered, err := p.registeredClaims(p.mfaTTL)
+	if err != nil {
+		return "", err
+	}
+	token, err := p.sign(&Claims{
+		RegisteredClaims: registered,
+		TokenUse:         TokenUseMFA,
+		Id:               id,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to sign mfa token")
+	}
+	return token, nil
+}
+
+// parse verifies the token signature, lifetime, issuer and audience and
+// rejects tokens issued for another use.
+func (p *TokenProvider) parse(tokenString string, use string) (*Claims, error) {
 	f := func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		// Tokens issued before kid was introduced have no kid header,
+		// they can only be verified by the active key.
+		key := p.keys.Active()
+		if kid, ok := token.Header["kid"].(string); ok {
+			key, ok = p.keys.Lookup(kid)
+			if !ok {
+				return nil, ErrInvalidToken
+			}
+		}
+		if token.Method.Alg() != key.Alg() {
 			return nil, ErrInvalidToken
 		}
-		return p.secret, nil
+		return key.verifyKey, nil
 	}
-	token, err := jwt.ParseWithClaims(refreshToken, &Claims{}, f)
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, f,
+		jwt.WithIssuer(p.issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
 	if err != nil {
-		return 0, ErrInvalidToken
+		return nil, ErrInvalidToken
 	}
 	if !token.Valid {
-		return 0, ErrInvalidToken
+		return nil, ErrInvalidToken
 	}
 	claims, ok := token.Claims.(*Claims)
 	if !ok {
-		return 0, ErrInvalidToken
+		return nil, ErrInvalidToken
+	}
+	if claims.TokenUse != use || !p.audienceMatches(claims.Audience) {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// audienceMatches requires the token to be intended for at least one of
+// the configured audiences.
+func (p *TokenProvider) audienceMatches(aud jwt.ClaimStrings) bool {
+	if len(p.audience) == 0 {
+		return true
+	}
+	for _, a := range p.audience {
+		if slices.Contains(aud, a) {
+			return true
+		}
 	}
-	return claims.Id, nil
+	return false
 }
 
-func (p *TokenProvider) NewPair(email string, id int64, isAdmin bool) (*models.TokenPair, error) {
-	accessClaims := p.newAccessClaims(email, id, isAdmin)
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims)
-	accessString, err := accessToken.SignedString(p.secret)
+// NewPair issues an access and a refresh token for the session.
+// The roles and permissions of access are only put in the access token.
+func (p *TokenProvider) NewPair(email string, id int64, isAdmin bool, access models.UserAccess, s models.Session) (*models.TokenPair, error) {
+	accessClaims, err := p.newAccessClaims(email, id, isAdmin, access, s)
+	if err != nil {
+		return nil, err
+	}
+	return p.signPair(accessClaims, id, s.Id)
+}
+
+// NewOAuthPair issues a token pair for the session of an OAuth client.
+// The access token carries the granted scope instead of the roles and
+// permissions of the user.
+func (p *TokenProvider) NewOAuthPair(id int64, s models.Session) (*models.TokenPair, error) {
+	registered, err := p.registeredClaims(p.tokenTTL)
+	if err != nil {
+		return nil, err
+	}
+	registered.Subject = strconv.FormatInt(id, 10)
+	accessClaims := &Claims{
+		RegisteredClaims: registered,
+		TokenUse:         TokenUseOAuthAccess,
+		Id:               id,
+		SessionId:        s.Id,
+		ClientId:         s.ClientId,
+		Scope:            s.Scope,
+		AuthTime:         jwt.NewNumericDate(s.AuthTime),
+	}
+	return p.signPair(accessClaims, id, s.Id)
+}
+
+func (p *TokenProvider) signPair(accessClaims *Claims, id int64, sid string) (*models.TokenPair, error) {
+	accessString, err := p.sign(accessClaims)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to sign access token")
 	}
 
-	refreshClaims := p.newRefreshClaims(id)
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims)
-	refreshString, err := refreshToken.SignedString(p.secret)
+	refreshClaims, err := p.newRefreshClaims(id, sid)
+	if err != nil {
+		return nil, err
+	}
+	refreshString, err := p.sign(refreshClaims)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to sign refresh token")
 	}
 
 	return &models.TokenPair{
-		AccessToken:  accessString,
-		RefreshToken: refreshString,
+		AccessToken:      accessString,
+		RefreshToken:     refreshString,
+		AccessExpiresAt:  accessClaims.ExpiresAt.Time,
+		RefreshExpiresAt: refreshClaims.ExpiresAt.Time,
 	}, nil
 }
 
+// NewIDToken issues an OpenID Connect ID token for the client. Its
+// audience is the client, so it is never accepted as an access token.
+func (p *TokenProvider) NewIDToken(t models.IDToken) (string, error) {
+	registered, err := p.registeredClaims(p.tokenTTL)
+	if err != nil {
+		return "", err
+	}
+	registered.Subject = strconv.FormatInt(t.UserId, 10)
+	registered.Audience = jwt.ClaimStrings{t.ClientId}
+	claims := &IDTokenClaims{
+		RegisteredClaims: registered,
+		Nonce:            t.Nonce,
+		AuthTime:         jwt.NewNumericDate(t.AuthTime),
+	}
+	if t.Email != "" {
+		claims.Email = t.Email
+		claims.EmailVerified = &t.EmailVerified
+	}
+	token, err := p.sign(claims)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to sign id token")
+	}
+	return token, nil
+}
+
+// NewServiceToken issues an access token for the service account. It
+// carries the granted scope instead of user claims.
+func (p *TokenProvider) NewServiceToken(clientId string, scope string) (*models.ServiceToken, error) {
+	registered, err := p.registeredClaims(p.tokenTTL)
+	if err != nil {
+		return nil, err
+	}
+	registered.Subject = ServiceSubjectPrefix + clientId
+	token, err := p.sign(&Claims{
+		RegisteredClaims: registered,
+		TokenUse:         TokenUseAccess,
+		Scope:            scope,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to sign service token")
+	}
+	return &models.ServiceToken{
+		AccessToken: token,
+		Scope:       scope,
+		ExpiresAt:   registered.ExpiresAt.Time,
+	}, nil
+}
+
+// Issuer is the iss claim of the issued tokens.
+func (p *TokenProvider) Issuer() string {
+	return p.issuer
+}
+
+// SigningAlg is the algorithm tokens are currently signed with.
+func (p *TokenProvider) SigningAlg() string {
+	return p.keys.Active().Alg()
+}
+
+func (p *TokenProvider) sign(claims jwt.Claims) (string, error) {
+	key := p.keys.Active()
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.Id
+	return token.SignedString(key.signKey)
+}
+
 type Claims struct {
 	jwt.RegisteredClaims
-	Email   string `json:"email,omitempty"`
-	Id      int64  `json:"id"`
-	IsAdmin *bool  `json:"isAdmin,omitempty"`
+	TokenUse    string   `json:"token_use"`
+	Email       string   `json:"email,omitempty"`
+	Id          int64    `json:"id"`
+	IsAdmin     *bool    `json:"isAdmin,omitempty"`
+	SessionId   string   `json:"sid,omitempty"`
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	Scope       string   `json:"scope,omitempty"`
+	ClientId    string   `json:"client_id,omitempty"`
+	// AuthTime is when the user authenticated to start the session.
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
 }
 
-func (p *TokenProvider) newAccessClaims(email string, id int64, isAdmin bool) *Claims {
-	return &Claims{
-		RegisteredClaims: jwt.RegisteredClaims{
-			Issuer:    p.serviceName,
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(p.tokenTTL)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
-		Email:   email,
-		Id:      id,
-		IsAdmin: &isAdmin,
+// ServiceAccount returns the client id of service account tokens.
+func (c *Claims) ServiceAccount() (string, bool) {
+	return strings.CutPrefix(c.Subject, ServiceSubjectPrefix)
+}
+
+type IDTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce         string           `json:"nonce,omitempty"`
+	AuthTime      *jwt.NumericDate `json:"auth_time,omitempty"`
+	Email         string           `json:"email,omitempty"`
+	EmailVerified *bool            `json:"email_verified,omitempty"`
+}
+
+func (p *TokenProvider) newAccessClaims(email string, id int64, isAdmin bool, access models.UserAccess, s models.Session) (*Claims, error) {
+	registered, err := p.registeredClaims(p.tokenTTL)
+	if err != nil {
+		return nil, err
 	}
+	return &Claims{
+		RegisteredClaims: registered,
+		TokenUse:         TokenUseAccess,
+		Email:            email,
+		Id:               id,
+		IsAdmin:          &isAdmin,
+		SessionId:        s.Id,
+		Roles:            access.Roles,
+		Permissions:      access.Permissions,
+		AuthTime:         jwt.NewNumericDate(s.AuthTime),
+	}, nil
 }
 
-func (p *TokenProvider) newRefreshClaims(id int64) *Claims {
+func (p *TokenProvider) newRefreshClaims(id int64, sid string) (*Claims, error) {
+	registered, err := p.registeredClaims(p.refreshTTL)
+	if err != nil {
+		return nil, err
+	}
 	return &Claims{
-		RegisteredClaims: jwt.RegisteredClaims{
-			Issuer:    p.serviceName,
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(p.refreshTTL)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
-		Id: id,
+		RegisteredClaims: registered,
+		TokenUse:         TokenUseRefresh,
+		Id:               id,
+		SessionId:        sid,
+	}, nil
+}
+
+// registeredClaims sets a random jti, so tokens issued within the same
+// second are still unique.
+func (p *TokenProvider) registeredClaims(ttl time.Duration) (jwt.RegisteredClaims, error) {
+	jti, err := randomID()
+	if err != nil {
+		return jwt.RegisteredClaims{}, errors.Wrap(err, "failed to generate token id")
+	}
+	now := time.Now()
+	return jwt.RegisteredClaims{
+		ID:        jti,
+		Issuer:    p.issuer,
+		Audience:  p.audience,
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		IssuedAt:  jwt.NewNumericDate(now),
+	}, nil
+}
+
+func randomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
 	}
+	return hex.EncodeToString(b), nil
 }
@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+const (
+	AuditRegister           = "register"
+	AuditLoginSucceeded     = "login_succeeded"
+	AuditLoginFailed        = "login_failed"
+	AuditRefresh            = "refresh"
+	AuditRefreshTokenReused = "refresh_token_reused"
+	AuditSetBanned          = "set_banned"
+	AuditSetDeleted         = "set_deleted"
+	AuditSetAdmin           = "set_admin"
+	AuditUnlockUser         = "unlock_user"
+	AuditCreateRole         = "create_role"
+	AuditGrantPermission    = "grant_permission"
+	AuditRevokePermission   = "revoke_permission"
+	AuditAssignRole         = "assign_role"
+	AuditUnassignRole       = "unassign_role"
+	AuditMFAEnabled         = "mfa_enabled"
+	AuditWebAuthnRegistered = "webauthn_registered"
+	AuditOAuthClientCreated = "oauth_client_created"
+	AuditOAuthClientDeleted = "oauth_client_deleted"
+	AuditOAuthAuthorized    = "oauth_authorized"
+
+	AuditServiceAccountCreated  = "service_account_created"
+	AuditServiceAccountRotated  = "service_account_rotated"
+	AuditServiceAccountDisabled = "service_account_disabled"
+)
+
+// AuditEvent records a security relevant action. ActorId is the user who
+// performed it and TargetId the user it was performed on, 0 if unknown.
+// Actions of service accounts have ActorServiceAccount set instead.
+type AuditEvent struct {
+	Id                  int64
+	Type                string
+	ActorId             int64
+	ActorServiceAccount string
+	TargetId            int64
+	IP                  string
+	RequestId           string
+	Details             string
+	CreatedAt           time.Time
+}
+
+// AuditFilter restricts listed events, zero values match every event.
+type AuditFilter struct {
+	Type                string
+	ActorId             int64
+	ActorServiceAccount string
+	TargetId            int64
+	From                *time.Time
+	To                  *time.Time
+}
+
+type ListAuditEventsQuery struct {
+	Filter    AuditFilter
+	PageSize  int
+	PageToken string
+}
+
+type AuditEventList struct {
+	Events        []*AuditEvent
+	NextPageToken string
+}
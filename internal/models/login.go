@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// LoginThrottle counts the failed logins of an account or a client IP.
+type LoginThrottle struct {
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   *time.Time
+}
@@ -0,0 +1,8 @@
+package models
+
+// Message is a notification sent to a user out of band.
+type Message struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
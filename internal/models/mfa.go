@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// TOTP is the authenticator of a user. Secret is encrypted, LastCounter is
+// the period of the last accepted code. The enrollment is pending until
+// ConfirmedAt is set.
+type TOTP struct {
+	UserId      int64
+	Secret      []byte
+	LastCounter int64
+	CreatedAt   time.Time
+	ConfirmedAt *time.Time
+}
+
+type TOTPEnrollment struct {
+	Secret string
+	URI    string
+}
+
+// LoginResult holds either the tokens or, if the user has to pass a
+// second factor, the MFA challenge token.
+type LoginResult struct {
+	Tokens   *TokenPair
+	MFAToken string
+}
@@ -0,0 +1,69 @@
+package models
+
+import "time"
+
+// OAuthClient is an application using snauth as its OpenID provider.
+// Public clients, like single page apps, have no secret and rely on PKCE
+// alone.
+type OAuthClient struct {
+	Id           int64
+	ClientId     string
+	Name         string
+	SecretHash   string
+	RedirectURIs []string
+	CreatedAt    time.Time
+}
+
+func (c *OAuthClient) Public() bool {
+	return c.SecretHash == ""
+}
+
+// AuthorizationRequest holds the parameters of an authorization code
+// request that are bound to the issued code.
+type AuthorizationRequest struct {
+	ClientId      string
+	RedirectURI   string
+	Scope         string
+	Nonce         string
+	CodeChallenge string
+}
+
+type AuthorizationCode struct {
+	Id            int64
+	CodeHash      string
+	ClientId      string
+	UserId        int64
+	RedirectURI   string
+	Scope         string
+	Nonce         string
+	CodeChallenge string
+	AuthTime      time.Time
+	CreatedAt     time.Time
+	ExpiresAt     time.Time
+	UsedAt        *time.Time
+}
+
+// IDToken holds the claims of an OpenID Connect ID token. Email is only
+// set if the client was granted the email scope.
+type IDToken struct {
+	UserId        int64
+	ClientId      string
+	Nonce         string
+	AuthTime      time.Time
+	Email         string
+	EmailVerified bool
+}
+
+// UserInfo holds the claims the userinfo endpoint returns. Email is only
+// set if the client was granted the email scope.
+type UserInfo struct {
+	UserId        int64
+	Email         string
+	EmailVerified bool
+}
+
+type OIDCTokens struct {
+	*TokenPair
+	IDToken string
+	Scope   string
+}
@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+const (
+	PermUsersRead       = "users.read"
+	PermUsersBan        = "users.ban"
+	PermUsersDelete     = "users.delete"
+	PermUsersUnlock     = "users.unlock"
+	PermUsersAdmin      = "users.admin"
+	PermRolesManage     = "roles.manage"
+	PermKeysRotate      = "keys.rotate"
+	PermAuditRead       = "audit.read"
+	PermClientsManage   = "clients.manage"
+	PermServicesManage  = "services.manage"
+	PermRevocationsRead = "revocations.read"
+)
+
+// Permissions lists every permission a role can be granted.
+// Admins hold all of them without any role.
+var Permissions = []string{
+	PermUsersRead,
+	PermUsersBan,
+	PermUsersDelete,
+	PermUsersUnlock,
+	PermUsersAdmin,
+	PermRolesManage,
+	PermKeysRotate,
+	PermAuditRead,
+	PermClientsManage,
+	PermServicesManage,
+	PermRevocationsRead,
+}
+
+type Role struct {
+	Id          int64
+	Name        string
+	Permissions []string
+	CreatedAt   time.Time
+}
+
+// UserAccess holds the roles assigned to a user and the permissions
+// granted through them.
+type UserAccess struct {
+	Roles       []string
+	Permissions []string
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+const (
+	RevocationReasonLogout  = "logout"
+	RevocationReasonBanned  = "banned"
+	RevocationReasonDeleted = "deleted"
+	// RevocationReasonPassword is used when the password changes.
+	RevocationReasonPassword = "password"
+)
+
+// RevocationEvent tells verifiers to reject the user's tokens issued at
+// or before RevokedAt.
+type RevocationEvent struct {
+	UserId    int64
+	RevokedAt time.Time
+	Reason    string
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// ServiceAccount is the identity of a backend service. It has no email or
+// password and authenticates with its client id and secret.
+type ServiceAccount struct {
+	Id              int64
+	ClientId        string
+	Name            string
+	SecretHash      string
+	Scopes          []string
+	CreatedAt       time.Time
+	SecretRotatedAt *time.Time
+	DisabledAt      *time.Time
+}
+
+func (a *ServiceAccount) Disabled() bool {
+	return a.DisabledAt != nil
+}
+
+// ServiceToken is an access token issued to a service account.
+type ServiceToken struct {
+	AccessToken string
+	Scope       string
+	ExpiresAt   time.Time
+}
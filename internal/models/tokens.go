@@ -1,6 +1,94 @@
 package models
 
+import "time"
+
 type TokenPair struct {
-	AccessToken  string
-	RefreshToken string
+	AccessToken      string
+	RefreshToken     string
+	AccessExpiresAt  time.Time
+	RefreshExpiresAt time.Time
+}
+
+type RefreshToken struct {
+	Id        int64
+	UserId    int64
+	FamilyId  string
+	ClientId  string
+	Scope     string
+	TokenHash string
+	AuthTime  time.Time
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+}
+
+func (t *RefreshToken) Session() Session {
+	return Session{Id: t.FamilyId, ClientId: t.ClientId, Scope: t.Scope, AuthTime: t.AuthTime}
+}
+
+// Session is a refresh token family. AuthTime is when the user
+// authenticated to start it. Sessions of OAuth clients have ClientId set
+// and are limited to the granted Scope.
+type Session struct {
+	Id       string
+	ClientId string
+	Scope    string
+	AuthTime time.Time
+}
+
+// TokenIntrospection describes an access token. Tokens of service
+// accounts have ServiceAccount and Scope set instead of a user.
+type TokenIntrospection struct {
+	Active         bool
+	UserId         int64
+	ServiceAccount string
+	Scope          string
+	Email          string
+	IsAdmin        bool
+	Roles          []string
+	Permissions    []string
+	ExpiresAt      time.Time
+	IssuedAt       time.Time
+}
+
+// JWK is a public JSON Web Key as defined in RFC 7517.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+const (
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeEmailVerification = "email_verification"
+	TokenPurposeEmailLogin        = "email_login"
+)
+
+// OneTimeToken is a single-use secret sent to the user out of band.
+type OneTimeToken struct {
+	Id        int64
+	UserId    int64
+	Purpose   string
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+// SigningKey is a token signing key created by a runtime rotation.
+// PrivateKey is encrypted. The active key has no RetiredAt.
+type SigningKey struct {
+	Id          string
+	Algorithm   string
+	PrivateKey  []byte
+	CreatedAt   time.Time
+	ActivatesAt time.Time
+	RetiredAt   *time.Time
 }
@@ -10,4 +10,56 @@ type User struct {
 	IsBanned  bool
 	IsDeleted bool
 	IsAdmin   bool
+	// TokensValidAfter is set when the user logs out of every session,
+	// tokens issued until then are no longer accepted.
+	TokensValidAfter *time.Time
+	EmailVerifiedAt  *time.Time
+}
+
+const (
+	UserSortById        = "id"
+	UserSortByCreatedAt = "created_at"
+)
+
+// UserFilter narrows a user listing, nil and empty fields match any user.
+type UserFilter struct {
+	IsBanned      *bool
+	IsDeleted     *bool
+	IsAdmin       *bool
+	CreatedFrom   *time.Time
+	CreatedTo     *time.Time
+	EmailContains string
+}
+
+// UserCursor is the position of the last user of a page.
+type UserCursor struct {
+	Id        int64
+	CreatedAt time.Time
+}
+
+type UserPage struct {
+	SortBy     string
+	Descending bool
+	Limit      int
+	After      *UserCursor
+}
+
+type ListUsersQuery struct {
+	Filter     UserFilter
+	SortBy     string
+	Descending bool
+	PageSize   int
+	PageToken  string
+}
+
+type UserList struct {
+	Users         []*User
+	NextPageToken string
+	Total         int64
+}
+
+// PasswordViolation is a password policy rule a password breaks.
+type PasswordViolation struct {
+	Rule        string
+	Description string
 }
@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+const (
+	WebAuthnCeremonyRegistration = "registration"
+	WebAuthnCeremonyLogin        = "login"
+)
+
+// WebAuthnCredential is a passkey or security key registered by a user.
+// CredentialId is the id the authenticator assigned to it.
+type WebAuthnCredential struct {
+	Id              int64
+	UserId          int64
+	CredentialId    []byte
+	Name            string
+	PublicKey       []byte
+	AttestationType string
+	Transports      []string
+	AAGUID          []byte
+	SignCount       uint32
+	BackupEligible  bool
+	BackupState     bool
+	CreatedAt       time.Time
+	LastUsedAt      *time.Time
+}
+
+// WebAuthnSession keeps the challenge of a ceremony between its begin and
+// finish calls. Data is the session data of the WebAuthn library as JSON.
+// UserId is 0 for logins offered a decoy credential.
+type WebAuthnSession struct {
+	UserId    int64
+	Ceremony  string
+	TokenHash string
+	Data      []byte
+	ExpiresAt time.Time
+}
+
+// WebAuthnChallenge is handed to the client to run a ceremony with.
+// Options is the JSON to pass to navigator.credentials, SessionToken
+// identifies the ceremony when finishing it.
+type WebAuthnChallenge struct {
+	SessionToken string
+	Options      []byte
+}
@@ -0,0 +1,63 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/vindosVP/snauth/internal/models"
+)
+
+// Log writes messages to the service log. It is meant for development,
+// message bodies contain secrets.
+type Log struct {
+	l zerolog.Logger
+}
+
+func NewLog(l zerolog.Logger) *Log {
+	return &Log{l: l}
+}
+
+func (n *Log) Notify(_ context.Context, m models.Message) error {
+	n.l.Info().Str("to", m.To).Str("subject", m.Subject).Str("body", m.Body).Msg("notification")
+	return nil
+}
+
+// File appends messages to a file as JSON lines, so tests and local
+// setups can read them back.
+type File struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewFile(path string) *File {
+	return &File{path: path}
+}
+
+type fileRecord struct {
+	models.Message
+	SentAt time.Time `json:"sentAt"`
+}
+
+func (n *File) Notify(_ context.Context, m models.Message) error {
+	b, err := json.Marshal(fileRecord{Message: m, SentAt: time.Now()})
+	if err != nil {
+		return errors.Wrap(err, "failed to encode notification")
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	f, err := os.OpenFile(n.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return errors.Wrap(err, "failed to open notifications file")
+	}
+	defer f.Close()
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		return errors.Wrap(err, "failed to write notification")
+	}
+	return nil
+}
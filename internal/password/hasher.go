@@ -0,0 +1,154 @@
+package password
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	AlgBcrypt   = "bcrypt"
+	AlgArgon2id = "argon2id"
+)
+
+var (
+	ErrMismatchedPassword = errors.New("password does not match hash")
+	ErrUnknownHashFormat  = errors.New("unknown password hash format")
+)
+
+// Bcrypt and Argon2id hash new passwords with one algorithm, but compare
+// against hashes of every supported algorithm, so stored hashes keep
+// working when the configured algorithm changes.
+type Bcrypt struct {
+	Cost int
+}
+
+func (b Bcrypt) Hash(password string) ([]byte, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to hash password")
+	}
+	return hash, nil
+}
+
+func (b Bcrypt) Compare(hash []byte, password string) error {
+	return compare(hash, password)
+}
+
+func (b Bcrypt) NeedsRehash(hash []byte) bool {
+	cost, err := bcrypt.Cost(hash)
+	return err != nil || cost != b.Cost
+}
+
+// Argon2id hashes passwords into PHC strings like
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>.
+type Argon2id struct {
+	// Memory is in KiB.
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+func (a Argon2id) Hash(password string) ([]byte, error) {
+	salt := make([]byte, a.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, errors.Wrap(err, "failed to generate salt")
+	}
+	p := argon2Params{
+		memory:      a.Memory,
+		iterations:  a.Iterations,
+		parallelism: a.Parallelism,
+		salt:        salt,
+	}
+	p.key = argon2.IDKey([]byte(password), salt, a.Iterations, a.Memory, a.Parallelism, a.KeyLength)
+	return []byte(p.String()), nil
+}
+
+func (a Argon2id) Compare(hash []byte, password string) error {
+	return compare(hash, password)
+}
+
+func (a Argon2id) NeedsRehash(hash []byte) bool {
+	p, err := parseArgon2id(hash)
+	if err != nil {
+		return true
+	}
+	return p.memory != a.Memory ||
+		p.iterations != a.Iterations ||
+		p.parallelism != a.Parallelism ||
+		uint32(len(p.salt)) != a.SaltLength ||
+		uint32(len(p.key)) != a.KeyLength
+}
+
+// compare detects the algorithm of the hash and checks the password against it.
+func compare(hash []byte, password string) error {
+	if bytes.HasPrefix(hash, []byte("$"+AlgArgon2id+"$")) {
+		p, err := parseArgon2id(hash)
+		if err != nil {
+			return err
+		}
+		key := argon2.IDKey([]byte(password), p.salt, p.iterations, p.memory, p.parallelism, uint32(len(p.key)))
+		if subtle.ConstantTimeCompare(key, p.key) != 1 {
+			return ErrMismatchedPassword
+		}
+		return nil
+	}
+	if _, err := bcrypt.Cost(hash); err != nil {
+		return ErrUnknownHashFormat
+	}
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return ErrMismatchedPassword
+		}
+		return errors.Wrap(err, "failed to compare bcrypt hash")
+	}
+	return nil
+}
+
+type argon2Params struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+func (p argon2Params) String() string {
+	enc := base64.RawStdEncoding
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		AlgArgon2id, argon2.Version, p.memory, p.iterations, p.parallelism,
+		enc.EncodeToString(p.salt), enc.EncodeToString(p.key))
+}
+
+func parseArgon2id(hash []byte) (argon2Params, error) {
+	var p argon2Params
+	parts := strings.Split(string(hash), "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != AlgArgon2id {
+		return p, ErrUnknownHashFormat
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, ErrUnknownHashFormat
+	}
+	_, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.iterations, &p.parallelism)
+	if err != nil {
+		return p, ErrUnknownHashFormat
+	}
+	enc := base64.RawStdEncoding
+	if p.salt, err = enc.DecodeString(parts[4]); err != nil {
+		return p, ErrUnknownHashFormat
+	}
+	if p.key, err = enc.DecodeString(parts[5]); err != nil || len(p.key) == 0 {
+		return p, ErrUnknownHashFormat
+	}
+	return p, nil
+}
@@ -0,0 +1,114 @@
+package password
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+
+	"github.com/vindosVP/snauth/internal/models"
+)
+
+// MaxBytes is the length bcrypt silently truncates passwords to.
+const MaxBytes = 72
+
+const (
+	RuleMinLength   = "min_length"
+	RuleMaxLength   = "max_length"
+	RuleUppercase   = "uppercase"
+	RuleLowercase   = "lowercase"
+	RuleDigit       = "digit"
+	RuleSymbol      = "symbol"
+	RuleNotEmail    = "not_email"
+	RuleBlocklisted = "not_common"
+)
+
+type PolicyConfig struct {
+	// MinLength is counted in characters.
+	MinLength int
+	// MaxLength is counted in bytes. With bcrypt it must not exceed
+	// MaxBytes, longer passwords would be truncated.
+	MaxLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+}
+
+type Policy struct {
+	cfg       PolicyConfig
+	blocklist map[string]struct{}
+}
+
+// NewPolicy creates a policy rejecting the passwords in blocklist,
+// which may be nil.
+func NewPolicy(cfg PolicyConfig, blocklist map[string]struct{}) *Policy {
+	if cfg.MaxLength <= 0 {
+		cfg.MaxLength = MaxBytes
+	}
+	return &Policy{cfg: cfg, blocklist: blocklist}
+}
+
+// LoadBlocklist reads common passwords from a file with one password per
+// line. Empty lines and lines starting with # are skipped.
+func LoadBlocklist(path string) (map[string]struct{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open blocklist")
+	}
+	defer f.Close()
+	blocklist := make(map[string]struct{})
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		blocklist[strings.ToLower(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read blocklist")
+	}
+	return blocklist, nil
+}
+
+// Validate returns every rule the password breaks, nil if it is accepted.
+func (p *Policy) Validate(email string, password string) []models.PasswordViolation {
+	var violations []models.PasswordViolation
+	add := func(rule string, description string) {
+		violations = append(violations, models.PasswordViolation{Rule: rule, Description: description})
+	}
+	if utf8.RuneCountInString(password) < p.cfg.MinLength {
+		add(RuleMinLength, fmt.Sprintf("must be at least %d characters long", p.cfg.MinLength))
+	}
+	if len(password) > p.cfg.MaxLength {
+		add(RuleMaxLength, fmt.Sprintf("must be at most %d bytes long", p.cfg.MaxLength))
+	}
+	if p.cfg.RequireUpper && !strings.ContainsFunc(password, unicode.IsUpper) {
+		add(RuleUppercase, "must contain an uppercase letter")
+	}
+	if p.cfg.RequireLower && !strings.ContainsFunc(password, unicode.IsLower) {
+		add(RuleLowercase, "must contain a lowercase letter")
+	}
+	if p.cfg.RequireDigit && !strings.ContainsFunc(password, unicode.IsDigit) {
+		add(RuleDigit, "must contain a digit")
+	}
+	if p.cfg.RequireSymbol && !strings.ContainsFunc(password, isSymbol) {
+		add(RuleSymbol, "must contain a symbol")
+	}
+	if email != "" && strings.EqualFold(password, email) {
+		add(RuleNotEmail, "must not be the email")
+	}
+	if _, ok := p.blocklist[strings.ToLower(password)]; ok {
+		add(RuleBlocklisted, "is too common")
+	}
+	return violations
+}
+
+func isSymbol(r rune) bool {
+	return unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r)
+}
@@ -0,0 +1,97 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often idle buckets are dropped.
+const sweepInterval = time.Minute
+
+// Limit allows Count calls per Period, all of which can be made at once.
+type Limit struct {
+	Count  int
+	Period time.Duration
+}
+
+// ParseLimit parses limits like 10/1m.
+func ParseLimit(s string) (Limit, error) {
+	count, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("limit %q is not in the count/period format", s)
+	}
+	var l Limit
+	var err error
+	if l.Count, err = strconv.Atoi(count); err != nil || l.Count <= 0 {
+		return Limit{}, fmt.Errorf("limit %q has an invalid count", s)
+	}
+	if l.Period, err = time.ParseDuration(period); err != nil || l.Period <= 0 {
+		return Limit{}, fmt.Errorf("limit %q has an invalid period", s)
+	}
+	return l, nil
+}
+
+// perSecond is the rate the bucket refills at.
+func (l Limit) perSecond() float64 {
+	return float64(l.Count) / l.Period.Seconds()
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	// full is when the bucket has refilled and can be dropped.
+	full time.Time
+}
+
+// Memory is a token bucket limiter keeping its buckets in memory, so limits
+// apply to a single instance only.
+type Memory struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow takes a token from the bucket of key. If the bucket is empty it
+// returns false and how long to wait for the next token.
+func (m *Memory) Allow(key string, l Limit) (bool, time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	m.sweep(now)
+	rate := l.perSecond()
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.Count), updated: now}
+		m.buckets[key] = b
+	}
+	b.tokens = min(float64(l.Count), b.tokens+now.Sub(b.updated).Seconds()*rate)
+	b.updated = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	}
+	b.tokens--
+	b.full = now.Add(time.Duration((float64(l.Count) - b.tokens) / rate * float64(time.Second)))
+	return true, 0
+}
+
+func (m *Memory) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepInterval {
+		return
+	}
+	m.lastSweep = now
+	for key, b := range m.buckets {
+		if now.After(b.full) {
+			delete(m.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package reqctx
+
+import (
+	"context"
+	"slices"
+)
+
+// Caller is the authenticated user of a request. Service accounts have
+// no user, ServiceAccount is their client id and Permissions their scopes.
+type Caller struct {
+	Id             int64
+	ServiceAccount string
+	Email          string
+	IsAdmin        bool
+	Roles          []string
+	Permissions    []string
+}
+
+// Can reports whether the caller holds the permission. Admins hold every
+// permission.
+func (c *Caller) Can(permission string) bool {
+	return c.IsAdmin || slices.Contains(c.Permissions, permission)
+}
+
+type callerKey struct{}
+
+func WithCaller(ctx context.Context, c *Caller) context.Context {
+	return context.WithValue(ctx, callerKey{}, c)
+}
+
+func CallerFromContext(ctx context.Context) (*Caller, bool) {
+	c, ok := ctx.Value(callerKey{}).(*Caller)
+	return c, ok
+}
+
+type clientIPKey struct{}
+
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIP returns the address of the client, an empty string if it is unknown.
+func ClientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
+
+type requestIDKey struct{}
+
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the id the client sent with the request, an empty
+// string if there was none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
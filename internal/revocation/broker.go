@@ -0,0 +1,68 @@
+package revocation
+
+import (
+	"sync"
+
+	"github.com/vindosVP/snauth/internal/models"
+)
+
+const subscriberBuffer = 64
+
+// Broker fans revocation events out to the subscribers of this instance.
+// A subscriber that falls behind has its channel closed, so that it can
+// resubscribe instead of silently missing events.
+type Broker struct {
+	mu     sync.Mutex
+	subs   map[chan models.RevocationEvent]struct{}
+	closed bool
+}
+
+func NewBroker() *Broker {
+	return &Broker{subs: make(map[chan models.RevocationEvent]struct{})}
+}
+
+func (b *Broker) Publish(e models.RevocationEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe returns a channel of events and a function that cancels
+// the subscription.
+func (b *Broker) Subscribe() (<-chan models.RevocationEvent, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ch := make(chan models.RevocationEvent, subscriberBuffer)
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	b.subs[ch] = struct{}{}
+	cancel := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+	return ch, cancel
+}
+
+// Close ends every subscription, letting streaming RPCs finish on shutdown.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for ch := range b.subs {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
@@ -2,29 +2,77 @@ package server
 
 import (
 	"context"
+	"encoding/base64"
+	"time"
 
 	"github.com/pkg/errors"
 
 	"github.com/rs/zerolog"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	authv1 "github.com/vindosVP/snauth/gen/go"
 	"github.com/vindosVP/snauth/internal/models"
+	"github.com/vindosVP/snauth/internal/reqctx"
 	auth "github.com/vindosVP/snauth/internal/service"
 )
 
 type Auth interface {
 	Register(ctx context.Context, email string, password string) (int64, error)
-	Login(ctx context.Context, email string, password string) (*models.TokenPair, error)
+	Login(ctx context.Context, email string, password string) (*models.LoginResult, error)
 	Refresh(ctx context.Context, refreshToken string) (*models.TokenPair, error)
-	SetDeleted(ctx context.Context, id int64, deleted bool) (bool, error)
-	SetBanned(ctx context.Context, id int64, banned bool) (bool, error)
-	SetAdmin(ctx context.Context, id int64, admin bool) (bool, error)
+	SetDeleted(ctx context.Context, id int64, deleted bool, confirmSelf bool) (bool, error)
+	SetBanned(ctx context.Context, id int64, banned bool, confirmSelf bool) (bool, error)
+	SetAdmin(ctx context.Context, id int64, admin bool, confirmSelf bool) (bool, error)
+	Introspect(ctx context.Context, accessToken string) (*models.TokenIntrospection, error)
+	JWKS() []models.JWK
+	RotateSigningKey(ctx context.Context) (string, error)
+	Logout(ctx context.Context, refreshToken string) error
+	LogoutAll(ctx context.Context, userId int64) error
+	SubscribeRevocations() (<-chan models.RevocationEvent, func())
+	GetUser(ctx context.Context, id int64) (*models.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	ListUsers(ctx context.Context, q models.ListUsersQuery) (*models.UserList, error)
+	RequestPasswordReset(ctx context.Context, email string) error
+	ConfirmPasswordReset(ctx context.Context, token string, newPassword string) error
+	ChangePassword(ctx context.Context, userId int64, oldPassword string, newPassword string, revokeOthers bool) (*models.TokenPair, error)
+	VerifyEmail(ctx context.Context, token string) error
+	ResendVerification(ctx context.Context, email string) error
+	UnlockUser(ctx context.Context, id int64) error
+	ListAuditEvents(ctx context.Context, q models.ListAuditEventsQuery) (*models.AuditEventList, error)
+	CreateRole(ctx context.Context, name string, permissions []string) (*models.Role, error)
+	ListRoles(ctx context.Context) ([]*models.Role, error)
+	GrantPermission(ctx context.Context, roleName string, permission string) (*models.Role, error)
+	RevokePermission(ctx context.Context, roleName string, permission string) (*models.Role, error)
+	AssignRole(ctx context.Context, userId int64, roleName string) error
+	UnassignRole(ctx context.Context, userId int64, roleName string) error
+	BeginTOTPEnrollment(ctx context.Context, userId int64) (*models.TOTPEnrollment, error)
+	ConfirmTOTPEnrollment(ctx context.Context, userId int64, code string) ([]string, error)
+	VerifyMFA(ctx context.Context, mfaToken string, code string) (*models.TokenPair, error)
+	BeginWebAuthnRegistration(ctx context.Context, userId int64) (*models.WebAuthnChallenge, error)
+	FinishWebAuthnRegistration(ctx context.Context, userId int64, sessionToken string, name string, response []byte) (*models.WebAuthnCredential, error)
+	BeginWebAuthnLogin(ctx context.Context, email string) (*models.WebAuthnChallenge, error)
+	FinishWebAuthnLogin(ctx context.Context, sessionToken string, response []byte) (*models.TokenPair, error)
+	StartEmailLogin(ctx context.Context, email string) error
+	CompleteEmailLogin(ctx context.Context, token string) (*models.LoginResult, error)
+	CreateOAuthClient(ctx context.Context, name string, redirectURIs []string, public bool) (*models.OAuthClient, string, error)
+	ListOAuthClients(ctx context.Context) ([]*models.OAuthClient, error)
+	DeleteOAuthClient(ctx context.Context, clientId string) error
+	CreateServiceAccount(ctx context.Context, name string, scopes []string) (*models.ServiceAccount, string, error)
+	ListServiceAccounts(ctx context.Context) ([]*models.ServiceAccount, error)
+	RotateServiceAccountSecret(ctx context.Context, clientId string) (string, error)
+	DisableServiceAccount(ctx context.Context, clientId string) error
+	IssueServiceToken(ctx context.Context, clientId string, clientSecret string, scope string) (*models.ServiceToken, error)
 }
 
+// errorDomain is the domain of the ErrorInfo details the service returns.
+const errorDomain = "snauth"
+
 type server struct {
 	authv1.UnimplementedAuthServer
 	auth Auth
@@ -47,16 +95,32 @@ func requestID(ctx context.Context) (string, error) {
 	return MDreqId[0], nil
 }
 
+func callerID(ctx context.Context) int64 {
+	c, ok := reqctx.CallerFromContext(ctx)
+	if !ok {
+		return 0
+	}
+	return c.Id
+}
+
 func (s *server) SetBanned(ctx context.Context, in *authv1.SetBannedRequest) (*authv1.SetBannedResponse, error) {
 	reqId, err := requestID(ctx)
 	if err != nil {
 		s.l.Error().Err(err).Msg("failed to extract request ID")
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
-	l := s.l.With().Str("requestID", reqId).Int64("userId", in.GetUserId()).Bool("isBanned", in.GetIsBanned()).Logger()
+	l := s.l.With().Str("requestID", reqId).Int64("callerId", callerID(ctx)).Int64("userId", in.GetUserId()).Bool("isBanned", in.GetIsBanned()).Logger()
 	l.Info().Msg("setting banned flag to user")
-	isBanned, err := s.auth.SetBanned(ctx, in.GetUserId(), in.GetIsBanned())
+	isBanned, err := s.auth.SetBanned(ctx, in.GetUserId(), in.GetIsBanned(), in.GetConfirmSelf())
 	if err != nil {
+		if errors.Is(err, auth.ErrLastAdmin) {
+			l.Info().Msg("no active admin would be left")
+			return nil, preconditionStatus("LAST_ADMIN", err.Error())
+		}
+		if errors.Is(err, auth.ErrSelfChangeNotConfirmed) {
+			l.Info().Msg("self change is not confirmed")
+			return nil, preconditionStatus("SELF_CHANGE_NOT_CONFIRMED", err.Error())
+		}
 		if errors.Is(err, auth.ErrUserDoesNotExist) {
 			l.Info().Msg("user does not exist")
 			return nil, status.Error(codes.FailedPrecondition, "user does not exist")
@@ -74,10 +138,18 @@ func (s *server) SetAdminRights(ctx context.Context, in *authv1.SetAdminRightsRe
 		s.l.Error().Err(err).Msg("failed to extract request ID")
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
-	l := s.l.With().Str("requestID", reqId).Int64("userId", in.GetUserId()).Bool("isAdmin", in.GetIsAdmin()).Logger()
+	l := s.l.With().Str("requestID", reqId).Int64("callerId", callerID(ctx)).Int64("userId", in.GetUserId()).Bool("isAdmin", in.GetIsAdmin()).Logger()
 	l.Info().Msg("setting admin flag to user")
-	isAdmin, err := s.auth.SetAdmin(ctx, in.GetUserId(), in.GetIsAdmin())
+	isAdmin, err := s.auth.SetAdmin(ctx, in.GetUserId(), in.GetIsAdmin(), in.GetConfirmSelf())
 	if err != nil {
+		if errors.Is(err, auth.ErrLastAdmin) {
+			l.Info().Msg("no active admin would be left")
+			return nil, preconditionStatus("LAST_ADMIN", err.Error())
+		}
+		if errors.Is(err, auth.ErrSelfChangeNotConfirmed) {
+			l.Info().Msg("self change is not confirmed")
+			return nil, preconditionStatus("SELF_CHANGE_NOT_CONFIRMED", err.Error())
+		}
 		if errors.Is(err, auth.ErrUserDoesNotExist) {
 			l.Info().Msg("user does not exist")
 			return nil, status.Error(codes.FailedPrecondition, "user does not exist")
@@ -89,16 +161,45 @@ func (s *server) SetAdminRights(ctx context.Context, in *authv1.SetAdminRightsRe
 	return &authv1.SetAdminRightsResponse{IsAdmin: isAdmin, UserId: in.GetUserId()}, nil
 }
 
+func (s *server) UnlockUser(ctx context.Context, in *authv1.UnlockUserRequest) (*authv1.UnlockUserResponse, error) {
+	reqId, err := requestID(ctx)
+	if err != nil {
+		s.l.Error().Err(err).Msg("failed to extract request ID")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	l := s.l.With().Str("requestID", reqId).Int64("callerId", callerID(ctx)).Int64("userId", in.GetUserId()).Logger()
+	l.Info().Msg("unlocking user")
+	err = s.auth.UnlockUser(ctx, in.GetUserId())
+	if err != nil {
+		if errors.Is(err, auth.ErrUserDoesNotExist) {
+			l.Info().Msg("user does not exist")
+			return nil, status.Error(codes.FailedPrecondition, "user does not exist")
+		}
+		l.Error().Stack().Err(err).Msg("failed to unlock user")
+		return nil, status.Error(codes.Internal, "failed to unlock user")
+	}
+	l.Info().Msg("unlocked user successfully")
+	return &authv1.UnlockUserResponse{}, nil
+}
+
 func (s *server) SetDeleted(ctx context.Context, in *authv1.SetDeletedRequest) (*authv1.SetDeletedResponse, error) {
 	reqId, err := requestID(ctx)
 	if err != nil {
 		s.l.Error().Err(err).Msg("failed to extract request ID")
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
-	l := s.l.With().Str("requestID", reqId).Int64("userId", in.GetUserId()).Bool("isDeleted", in.GetIsDeleted()).Logger()
+	l := s.l.With().Str("requestID", reqId).Int64("callerId", callerID(ctx)).Int64("userId", in.GetUserId()).Bool("isDeleted", in.GetIsDeleted()).Logger()
 	l.Info().Msg("setting deleted flag to user")
-	isDeleted, err := s.auth.SetDeleted(ctx, in.GetUserId(), in.GetIsDeleted())
+	isDeleted, err := s.auth.SetDeleted(ctx, in.GetUserId(), in.GetIsDeleted(), in.GetConfirmSelf())
 	if err != nil {
+		if errors.Is(err, auth.ErrLastAdmin) {
+			l.Info().Msg("no active admin would be left")
+			return nil, preconditionStatus("LAST_ADMIN", err.Error())
+		}
+		if errors.Is(err, auth.ErrSelfChangeNotConfirmed) {
+			l.Info().Msg("self change is not confirmed")
+			return nil, preconditionStatus("SELF_CHANGE_NOT_CONFIRMED", err.Error())
+		}
 		if errors.Is(err, auth.ErrUserDoesNotExist) {
 			l.Info().Msg("user does not exist")
 			return nil, status.Error(codes.FailedPrecondition, "user does not exist")
@@ -119,7 +220,17 @@ func (s *server) Register(ctx context.Context, in *authv1.RegisterRequest) (*aut
 	l := s.l.With().Str("requestID", reqId).Str("email", in.GetEmail()).Logger()
 	l.Info().Msg("registering user")
 	id, err := s.auth.Register(ctx, in.GetEmail(), in.GetPassword())
+	var notSentErr *auth.VerificationNotSentError
+	if errors.As(err, &notSentErr) {
+		l.Warn().Err(err).Int64("userId", id).Msg("failed to send verification token")
+		err = nil
+	}
 	if err != nil {
+		var policyErr *auth.PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			l.Info().Err(err).Msg("password violates policy")
+			return nil, passwordPolicyStatus("password", policyErr)
+		}
 		if errors.Is(err, auth.ErrUserAlreadyExists) {
 			l.Info().Msg("user already exists")
 			return nil, status.Error(codes.FailedPrecondition, "user already exists")
@@ -139,8 +250,13 @@ func (s *server) Login(ctx context.Context, in *authv1.LoginRequest) (*authv1.Lo
 	}
 	l := s.l.With().Str("requestID", reqId).Str("email", in.GetEmail()).Logger()
 	l.Info().Msg("logging user in")
-	tokenPair, err := s.auth.Login(ctx, in.GetEmail(), in.GetPassword())
+	res, err := s.auth.Login(ctx, in.GetEmail(), in.GetPassword())
 	if err != nil {
+		var lockedErr *auth.LoginLockedError
+		if errors.As(err, &lockedErr) {
+			l.Info().Time("lockedUntil", lockedErr.Until).Msg("login is locked")
+			return nil, loginLockedStatus(lockedErr)
+		}
 		if errors.Is(err, auth.ErrInvalidLoginOrPassword) {
 			l.Info().Msg("invalid login or password")
 			return nil, status.Error(codes.InvalidArgument, "invalid login or password")
@@ -149,13 +265,21 @@ func (s *server) Login(ctx context.Context, in *authv1.LoginRequest) (*authv1.Lo
 			l.Info().Msg("user is deleted or banned")
 			return nil, status.Error(codes.FailedPrecondition, "user is deleted or banned")
 		}
+		if errors.Is(err, auth.ErrEmailNotVerified) {
+			l.Info().Msg("email is not verified")
+			return nil, status.Error(codes.FailedPrecondition, "email is not verified")
+		}
 		l.Error().Stack().Err(err).Msg("failed to log in user")
 		return nil, status.Error(codes.Internal, "failed to log in user")
 	}
+	if res.MFAToken != "" {
+		l.Info().Msg("mfa required to log in user")
+		return &authv1.LoginResponse{MfaToken: res.MFAToken}, nil
+	}
 	l.Info().Msg("logged in user successfully")
 	return &authv1.LoginResponse{
-		AccessToken:  tokenPair.AccessToken,
-		RefreshToken: tokenPair.RefreshToken,
+		AccessToken:  res.Tokens.AccessToken,
+		RefreshToken: res.Tokens.RefreshToken,
 	}, nil
 }
 
@@ -173,6 +297,10 @@ func (s *server) Refresh(ctx context.Context, in *authv1.RefreshRequest) (*authv
 			l.Info().Msg("invalid refresh token")
 			return nil, status.Error(codes.InvalidArgument, "invalid refresh token")
 		}
+		if errors.Is(err, auth.ErrRefreshTokenReused) {
+			l.Warn().Msg("refresh token reuse detected, session revoked")
+			return nil, status.Error(codes.InvalidArgument, "invalid refresh token")
+		}
 		if errors.Is(err, auth.ErrUserUnableToLogIn) {
 			l.Info().Msg("unable to refresh token")
 			return nil, status.Error(codes.FailedPrecondition, "unable to refresh token")
@@ -185,3 +313,1178 @@ func (s *server) Refresh(ctx context.Context, in *authv1.RefreshRequest) (*authv
 		RefreshToken: tokenPair.RefreshToken,
 	}, nil
 }
+
+func (s *server) Introspect(ctx context.Context, in *authv1.IntrospectRequest) (*authv1.IntrospectResponse, error) {
+	reqId, err := requestID(ctx)
+	if err != nil {
+		s.l.Error().Err(err).Msg("failed to extract request ID")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	l := s.l.With().Str("requestID", reqId).Logger()
+	l.Info().Msg("introspecting token")
+	ti, err := s.auth.Introspect(ctx, in.GetToken())
+	if err != nil {
+		l.Error().Stack().Err(err).Msg("failed to introspect token")
+		return nil, status.Error(codes.Internal, "failed to introspect token")
+	}
+	l.Info().Bool("active", ti.Active).Msg("introspected token successfully")
+	if !ti.Active {
+		return &authv1.IntrospectResponse{Active: false}, nil
+	}
+	return &authv1.IntrospectResponse{
+		Active:         true,
+		UserId:         ti.UserId,
+		Email:          ti.Email,
+		IsAdmin:        ti.IsAdmin,
+		Exp:            ti.ExpiresAt.Unix(),
+		Iat:            ti.IssuedAt.Unix(),
+		Roles:          ti.Roles,
+		Permissions:    ti.Permissions,
+		ServiceAccount: ti.ServiceAccount,
+		Scope:          ti.Scope,
+	}, nil
+}
+
+func (s *server) GetJWKS(_ context.Context, _ *authv1.GetJWKSRequest) (*authv1.GetJWKSResponse, error) {
+	keys := s.auth.JWKS()
+	resp := &authv1.GetJWKSResponse{Keys: make([]*authv1.JWK, 0, len(keys))}
+	for _, k := range keys {
+		resp.Keys = append(resp.Keys, &authv1.JWK{
+			Kty: k.Kty,
+			Kid: k.Kid,
+			Use: k.Use,
+			Alg: k.Alg,
+			N:   k.N,
+			E:   k.E,
+			Crv: k.Crv,
+			X:   k.X,
+			Y:   k.Y,
+		})
+	}
+	return resp, nil
+}
+
+func (s *server) RotateSigningKey(ctx context.Context, _ *authv1.RotateSigningKeyRequest) (*authv1.RotateSigningKeyResponse, error) {
+	reqId, err := requestID(ctx)
+	if err != nil {
+		s.l.Error().Err(err).Msg("failed to extract request ID")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	l := s.l.With().Str("requestID", reqId).Int64("callerId", callerID(ctx)).Logger()
+	l.Info().Msg("rotating signing key")
+	kid, err := s.auth.RotateSigningKey(ctx)
+	if err != nil {
+		if errors.Is(err, auth.ErrKeyRotationUnavailable) {
+			l.Warn().Msg("signing key rotation is not configured")
+			return nil, status.Error(codes.FailedPrecondition, "signing key rotation is not configured")
+		}
+		if errors.Is(err, auth.ErrKeyRotationPending) {
+			l.Info().Msg("previous signing key rotation is pending")
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		l.Error().Stack().Err(err).Msg("failed to rotate signing key")
+		return nil, status.Error(codes.Internal, "failed to rotate signing key")
+	}
+	l.Info().Str("kid", kid).Msg("rotated signing key successfully")
+	return &authv1.RotateSigningKeyResponse{Kid: kid}, nil
+}
+
+func (s *server) Logout(ctx context.Context, in *authv1.LogoutRequest) (*authv1.LogoutResponse, error) {
+	reqId, err := requestID(ctx)
+	if err != nil {
+		s.l.Error().Err(err).Msg("failed to extract request ID")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	l := s.l.With().Str("requestID", reqId).Logger()
+	l.Info().Msg("logging user out")
+	err = s.auth.Logout(ctx, in.GetRefreshToken())
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidRefreshToken) {
+			l.Info().Msg("invalid refresh token")
+			return nil, status.Error(codes.InvalidArgument, "invalid refresh token")
+		}
+		l.Error().Stack().Err(err).Msg("failed to log out user")
+		return nil, status.Error(codes.Internal, "failed to log out user")
+	}
+	l.Info().Msg("logged out user successfully")
+	return &authv1.LogoutResponse{}, nil
+}
+
+func (s *server) LogoutAll(ctx context.Context, _ *authv1.LogoutAllRequest) (*authv1.LogoutAllResponse, error) {
+	reqId, err := requestID(ctx)
+	if err != nil {
+		s.l.Error().Err(err).Msg("failed to extract request ID")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	id := callerID(ctx)
+	l := s.l.With().Str("requestID", reqId).Int64("userId", id).Logger()
+	l.Info().Msg("logging user out of all sessions")
+	err = s.auth.LogoutAll(ctx, id)
+	if err != nil {
+		if errors.Is(err, auth.ErrUserDoesNotExist) {
+			l.Info().Msg("user does not exist")
+			return nil, status.Error(codes.FailedPrecondition, "user does not exist")
+		}
+		l.Error().Stack().Err(err).Msg("failed to log out user of all sessions")
+		return nil, status.Error(codes.Internal, "failed to log out user of all sessions")
+	}
+	l.Info().Msg("logged out user of all sessions successfully")
+	return &authv1.LogoutAllResponse{}, nil
+}
+
+func (s *server) SubscribeRevocations(_ *authv1.SubscribeRevocationsRequest, stream authv1.Auth_SubscribeRevocationsServer) error {
+	reqId, err := requestID(stream.Context())
+	if err != nil {
+		s.l.Error().Err(err).Msg("failed to extract request ID")
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	l := s.l.With().Str("requestID", reqId).Int64("callerId", callerID(stream.Context())).Logger()
+	l.Info().Msg("subscribing to revocations")
+	events, cancel := s.auth.SubscribeRevocations()
+	defer cancel()
+	for {
+		select {
+		case <-stream.Context().Done():
+			l.Info().Msg("revocations subscriber disconnected")
+			return nil
+		case e, ok := <-events:
+			if !ok {
+				l.Info().Msg("revocations subscription closed")
+				return status.Error(codes.Unavailable, "subscription closed, resubscribe")
+			}
+			err := stream.Send(&authv1.RevocationEvent{
+				UserId:    e.UserId,
+				RevokedAt: e.RevokedAt.Unix(),
+				Reason:    e.Reason,
+			})
+			if err != nil {
+				l.Error().Err(err).Msg("failed to send revocation event")
+				return err
+			}
+		}
+	}
+}
+
+func (s *server) GetUser(ctx context.Context, in *authv1.GetUserRequest) (*authv1.GetUserResponse, error) {
+	reqId, err := requestID(ctx)
+	if err != nil {
+		s.l.Error().Err(err).Msg("failed to extract request ID")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	l := s.l.With().Str("requestID", reqId).Int64("callerId", callerID(ctx)).Logger()
+	var u *models.User
+	switch lookup := in.GetLookup().(type) {
+	case *authv1.GetUserRequest_UserId:
+		l = l.With().Int64("userId", lookup.UserId).Logger()
+		l.Info().Msg("getting user")
+		u, err = s.auth.GetUser(ctx, lookup.UserId)
+	case *authv1.GetUserRequest_Email:
+		l = l.With().Str("email", lookup.Email).Logger()
+		l.Info().Msg("getting user")
+		u, err = s.auth.GetUserByEmail(ctx, lookup.Email)
+	default:
+		l.Info().Msg("no user id or email")
+		return nil, status.Error(codes.InvalidArgument, "user id or email is required")
+	}
+	if err != nil {
+		if errors.Is(err, auth.ErrUserDoesNotExist) {
+			l.Info().Msg("user does not exist")
+			return nil, status.Error(codes.NotFound, "user does not exist")
+		}
+		l.Error().Stack().Err(err).Msg("failed to get user")
+		return nil, status.Error(codes.Internal, "failed to get user")
+	}
+	l.Info().Msg("got user successfully")
+	return &authv1.GetUserResponse{User: toProtoUser(u)}, nil
+}
+
+func (s *server) GetMe(ctx context.Context, _ *authv1.GetMeRequest) (*authv1.GetMeResponse, error) {
+	reqId, err := requestID(ctx)
+	if err != nil {
+		s.l.Error().Err(err).Msg("failed to extract request ID")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	id := callerID(ctx)
+	l := s.l.With().Str("requestID", reqId).Int64("userId", id).Logger()
+	l.Info().Msg("getting current user")
+	u, err := s.auth.GetUser(ctx, id)
+	if err != nil {
+		if errors.Is(err, auth.ErrUserDoesNotExist) {
+			l.Info().Msg("user does not exist")
+			return nil, status.Error(codes.NotFound, "user does not exist")
+		}
+		l.Error().Stack().Err(err).Msg("failed to get current user")
+		return nil, status.Error(codes.Internal, "failed to get current user")
+	}
+	l.Info().Msg("got current user successfully")
+	return &authv1.GetMeResponse{User: toProtoUser(u)}, nil
+}
+
+func (s *server) ListUsers(ctx context.Context, in *authv1.ListUsersRequest) (*authv1.ListUsersResponse, error) {
+	reqId, err := requestID(ctx)
+	if err != nil {
+		s.l.Error().Err(err).Msg("failed to extract request ID")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	l := s.l.With().Str("requestID", reqId).Int64("callerId", callerID(ctx)).Logger()
+	l.Info().Msg("listing users")
+	q := models.ListUsersQuery{
+		Filter: models.UserFilter{
+			IsBanned:      in.IsBanned,
+			IsDeleted:     in.IsDeleted,
+			IsAdmin:       in.IsAdmin,
+			EmailContains: in.GetEmailContains(),
+		},
+		SortBy:     models.UserSortById,
+		Descending: in.GetDescending(),
+		PageSize:   int(in.GetPageSize()),
+		PageToken:  in.GetPageToken(),
+	}
+	if in.GetSortBy() == authv1.UserSortField_USER_SORT_FIELD_CREATED_AT {
+		q.SortBy = models.UserSortByCreatedAt
+	}
+	if in.CreatedFrom != nil {
+		from := in.GetCreatedFrom().AsTime()
+		q.Filter.CreatedFrom = &from
+	}
+	if in.CreatedTo != nil {
+		to := in.GetCreatedTo().AsTime()
+		q.Filter.CreatedTo = &to
+	}
+	list, err := s.auth.ListUsers(ctx, q)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidPageToken) || errors.Is(err, auth.ErrInvalidSortField) {
+			l.Info().Err(err).Msg("invalid list users request")
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		l.Error().Stack().Err(err).Msg("failed to list users")
+		return nil, status.Error(codes.Internal, "failed to list users")
+	}
+	l.Info().Int("count", len(list.Users)).Msg("listed users successfully")
+	resp := &authv1.ListUsersResponse{
+		Users:         make([]*authv1.User, 0, len(list.Users)),
+		NextPageToken: list.NextPageToken,
+		TotalCount:    list.Total,
+	}
+	for _, u := range list.Users {
+		resp.Users = append(resp.Users, toProtoUser(u))
+	}
+	return resp, nil
+}
+
+func (s *server) RequestPasswordReset(ctx context.Context, in *authv1.RequestPasswordResetRequest) (*authv1.RequestPasswordResetResponse, error) {
+	reqId, err := requestID(ctx)
+	if err != nil {
+		s.l.Error().Err(err).Msg("failed to extract request ID")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	l := s.l.With().Str("requestID", reqId).Str("email", in.GetEmail()).Logger()
+	l.Info().Msg("requesting password reset")
+	err = s.auth.RequestPasswordReset(ctx, in.GetEmail())
+	if err != nil {
+		if errors.Is(err, auth.ErrTooManyPasswordResetRequests) {
+			l.Info().Msg("too many password reset requests")
+			return nil, status.Error(codes.ResourceExhausted, "too many password reset requests")
+		}
+		l.Error().Stack().Err(err).Msg("failed to request password reset")
+		return nil, status.Error(codes.Internal, "failed to request password reset")
+	}
+	l.Info().Msg("requested password reset successfully")
+	return &authv1.RequestPasswordResetResponse{}, nil
+}
+
+func (s *server) ConfirmPasswordReset(ctx context.Context, in *authv1.ConfirmPasswordResetRequest) (*authv1.ConfirmPasswordResetResponse, error) {
+	reqId, err := requestID(ctx)
+	if err != nil {
+		s.l.Error().Err(err).Msg("failed to extract request ID")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	l := s.l.With().Str("requestID", reqId).Logger()
+	l.Info().Msg("confirming password reset")
+	err = s.auth.ConfirmPasswordReset(ctx, in.GetToken(), in.GetNewPassword())
+	if err != nil {
+		var policyErr *auth.PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			l.Info().Err(err).Msg("password violates policy")
+			return nil, passwordPolicyStatus("newPassword", policyErr)
+		}
+		if errors.Is(err, auth.ErrInvalidResetToken) {
+			l.Info().Msg("invalid password reset token")
+			return nil, status.Error(codes.InvalidArgument, "invalid password reset token")
+		}
+		if errors.Is(err, auth.ErrUserUnableToLogIn) {
+			l.Info().Msg("user is deleted or banned")
+			return nil, status.Error(codes.FailedPrecondition, "user is deleted or banned")
+		}
+		l.Error().Stack().Err(err).Msg("failed to reset password")
+		return nil, status.Error(codes.Internal, "failed to reset password")
+	}
+	l.Info().Msg("reset password successfully")
+	return &authv1.ConfirmPasswordResetResponse{}, nil
+}
+
+func (s *server) ChangePassword(ctx context.Context, in *authv1.ChangePasswordRequest) (*authv1.ChangePasswordResponse, error) {
+	reqId, err := requestID(ctx)
+	if err != nil {
+		s.l.Error().Err(err).Msg("failed to extract request ID")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	id := callerID(ctx)
+	l := s.l.With().Str("requestID", reqId).Int64("userId", id).Bool("revokeOtherSessions", in.GetRevokeOtherSessions()).Logger()
+	l.Info().Msg("changing password")
+	tokenPair, err := s.auth.ChangePassword(ctx, id, in.GetOldPassword(), in.GetNewPassword(), in.GetRevokeOtherSessions())
+	if err != nil {
+		var lockedErr *auth.LoginLockedError
+		if errors.As(err, &lockedErr) {
+			l.Info().Time("lockedUntil", lockedErr.Until).Msg("password change is locked")
+			return nil, loginLockedStatus(lockedErr)
+		}
+		var policyErr *auth.PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			l.Info().Err(err).Msg("password violates policy")
+			return nil, passwordPolicyStatus("newPassword", policyErr)
+		}
+		if errors.Is(err, auth.ErrInvalidPassword) {
+			l.Info().Msg("invalid password")
+			return nil, status.Error(codes.InvalidArgument, "invalid password")
+		}
+		if errors.Is(err, auth.ErrUserDoesNotExist) {
+			l.Info().Msg("user does not exist")
+			return nil, status.Error(codes.FailedPrecondition, "user does not exist")
+		}
+		if errors.Is(err, auth.ErrUserUnableToLogIn) {
+			l.Info().Msg("user is deleted or banned")
+			return nil, status.Error(codes.FailedPrecondition, "user is deleted or banned")
+		}
+		l.Error().Stack().Err(err).Msg("failed to change password")
+		return nil, status.Error(codes.Internal, "failed to change password")
+	}
+	l.Info().Msg("changed password successfully")
+	if tokenPair == nil {
+		return &authv1.ChangePasswordResponse{}, nil
+	}
+	return &authv1.ChangePasswordResponse{
+		AccessToken:  tokenPair.AccessToken,
+		RefreshToken: tokenPair.RefreshToken,
+	}, nil
+}
+
+func (s *server) VerifyEmail(ctx context.Context, in *authv1.VerifyEmailRequest) (*authv1.VerifyEmailResponse, error) {
+	reqId, err := requestID(ctx)
+	if err != nil {
+		s.l.Error().Err(err).Msg("failed to extract request ID")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	l := s.l.With().Str("requestID", reqId).Logger()
+	l.Info().Msg("verifying email")
+	err = s.auth.VerifyEmail(ctx, in.GetToken())
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidVerificationToken) {
+			l.Info().Msg("invalid verification token")
+			return nil, status.Error(codes.InvalidArgument, "invalid verification token")
+		}
+		l.Error().Stack().Err(err).Msg("failed to verify email")
+		return nil, status.Error(codes.Internal, "failed to verify email")
+	}
+	l.Info().Msg("verified email successfully")
+	return &authv1.VerifyEmailResponse{}, nil
+}
+
+func (s *server) ResendVerification(ctx context.Context, in *authv1.ResendVerificationRequest) (*authv1.ResendVerificationResponse, error) {
+	reqId, err := requestID(ctx)
+	if err != nil {
+		s.l.Error().Err(err).Msg("failed to extract request ID")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	l := s.l.With().Str("requestID", reqId).Str("email", in.GetEmail()).Logger()
+	l.Info().Msg("resending verification")
+	err = s.auth.ResendVerification(ctx, in.GetEmail())
+	if err != nil {
+		if errors.Is(err, auth.ErrTooManyVerificationRequests) {
+			l.Info().Msg("too many verification requests")
+			return nil, status.Error(codes.ResourceExhausted, "too many verification requests")
+		}
+		l.Error().Stack().Err(err).Msg("failed to resend verification")
+		return nil, status.Error(codes.Internal, "failed to resend verification")
+	}
+	l.Info().Msg("resent verification successfully")
+	return &authv1.ResendVerificationResponse{}, nil
+}
+
+func (s *server) ListAuditEvents(ctx context.Context, in *authv1.ListAuditEventsRequest) (*authv1.ListAuditEventsResponse, error) {
+	reqId, err := requestID(ctx)
+	if err != nil {
+		s.l.Error().Err(err).Msg("failed to extract request ID")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	l := s.l.With().Str("requestID", reqId).Int64("callerId", callerID(ctx)).Logger()
+	l.Info().Msg("listing audit events")
+	q := models.ListAuditEventsQuery{
+		Filter: models.AuditFilter{
+			Type:                in.GetType(),
+			ActorId:             in.GetActorId(),
+			ActorServiceAccount: in.GetActorServiceAccount(),
+			TargetId:            in.GetTargetId(),
+		},
+		PageSize:  int(in.GetPageSize()),
+		PageToken: in.GetPageToken(),
+	}
+	if in.CreatedFrom != nil {
+		from := in.GetCreatedFrom().AsTime()
+		q.Filter.From = &from
+	}
+	if in.CreatedTo != nil {
+		to := in.GetCreatedTo().AsTime()
+		q.Filter.To = &to
+	}
+	list, err := s.auth.ListAuditEvents(ctx, q)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidPageToken) {
+			l.Info().Err(err).Msg("invalid list audit events request")
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		l.Error().Stack().Err(err).Msg("failed to list audit events")
+		return nil, status.Error(codes.Internal, "failed to list audit events")
+	}
+	l.Info().Int("count", len(list.Events)).Msg("listed audit events successfully")
+	resp := &authv1.ListAuditEventsResponse{
+		Events:        make([]*authv1.AuditEvent, 0, len(list.Events)),
+		NextPageToken: list.NextPageToken,
+	}
+	for _, e := range list.Events {
+		resp.Events = append(resp.Events, &authv1.AuditEvent{
+			Id:                  e.Id,
+			Type:                e.Type,
+			ActorId:             e.ActorId,
+			ActorServiceAccount: e.ActorServiceAccount,
+			TargetId:            e.TargetId,
+			Ip:                  e.IP,
+			RequestId:           e.RequestId,
+			Details:             e.Details,
+			CreatedAt:           timestamppb.New(e.CreatedAt),
+		})
+	}
+	return resp, nil
+}
+
+func (s *server) CreateRole(ctx context.Context, in *authv1.CreateRoleRequest) (*authv1.CreateRoleResponse, error) {
+	reqId, err := requestID(ctx)
+	if err != nil {
+		s.l.Error().Err(err).Msg("failed to extract request ID")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	l := s.l.With().Str("requestID", reqId).Int64("callerId", callerID(ctx)).Str("role", in.GetName()).Strs("permissions", in.GetPermissions()).Logger()
+	l.Info().Msg("creating role")
+	r, err := s.auth.CreateRole(ctx, in.GetName(), in.GetPermissions())
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidRoleName) || errors.Is(err, auth.ErrUnknownPermission) {
+			l.Info().Err(err).Msg("invalid create role request")
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if errors.Is(err, auth.ErrRoleAlreadyExists) {
+			l.Info().Msg("role already exists")
+			return nil, status.Error(codes.FailedPrecondition, "role already exists")
+		}
+		if errors.Is(err, auth.ErrPermissionNotHeld) {
+			l.Info().Msg("caller does not hold a permission of the role")
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		l.Error().Stack().Err(err).Msg("failed to create role")
+		return nil, status.Error(codes.Internal, "failed to create role")
+	}
+	l.Info().Msg("created role successfully")
+	return &authv1.CreateRoleResponse{Role: toProtoRole(r)}, nil
+}
+
+func (s *server) ListRoles(ctx context.Context, _ *authv1.ListRolesRequest) (*authv1.ListRolesResponse, error) {
+	reqId, err := requestID(ctx)
+	if err != nil {
+		s.l.Error().Err(err).Msg("failed to extract request ID")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	l := s.l.With().Str("requestID", reqId).Int64("callerId", callerID(ctx)).Logger()
+	l.Info().Msg("listing roles")
+	roles, err := s.auth.ListRoles(ctx)
+	if err != nil {
+		l.Error().Stack().Err(err).Msg("failed to list roles")
+		return nil, status.Error(codes.Internal, "failed to list roles")
+	}
+	l.Info().Int("count", len(roles)).Msg("listed roles successfully")
+	resp := &authv1.ListRolesResponse{Roles: make([]*authv1.Role, 0, len(roles))}
+	for _, r := range roles {
+		resp.Roles = append(resp.Roles, toProtoRole(r))
+	}
+	return resp, nil
+}
+
+func (s *server) GrantPermission(ctx context.Context, in *authv1.GrantPermissionRequest) (*authv1.GrantPermissionResponse, error) {
+	reqId, err := requestID(ctx)
+	if err != nil {
+		s.l.Error().Err(err).Msg("failed to extract request ID")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	l := s.l.With().Str("requestID", reqId).Int64("callerId", callerID(ctx)).Str("role", in.GetRole()).Str("permission", in.GetPermission()).Logger()
+	l.Info().Msg("granting permission")
+	r, err := s.auth.GrantPermission(ctx, in.GetRole(), in.GetPermission())
+	if err != nil {
+		return nil, s.permissionChangeError(l, err, "failed to grant permission")
+	}
+	l.Info().Msg("granted permission successfully")
+	return &authv1.GrantPermissionResponse{Role: toProtoRole(r)}, nil
+}
+
+func (s *server) RevokePermission(ctx context.Context, in *authv1.RevokePermissionRequest) (*authv1.RevokePermissionResponse, error) {
+	reqId, err := requestID(ctx)
+	if err != nil {
+		s.l.Error().Err(err).Msg("failed to extract request ID")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	l := s.l.With().Str("requestID", reqId).Int64("callerId", callerID(ctx)).Str("role", in.GetRole()).Str("permission", in.GetPermission()).Logger()
+	l.Info().Msg("revoking permission")
+	r, err := s.auth.RevokePermission(ctx, in.GetRole(), in.GetPermission())
+	if err != nil {
+		return nil, s.permissionChangeError(l, err, "failed to revoke permission")
+	}
+	l.Info().Msg("revoked permission successfully")
+	return &authv1.RevokePermissionResponse{Role: toProtoRole(r)}, nil
+}
+
+func (s *server) BeginTOTPEnrollment(ctx context.Context, _ *authv1.BeginTOTPEnrollmentRequest) (*authv1.BeginTOTPEnrollmentResponse, error) {
+	reqId, err := requestID(ctx)
+	if err != nil {
+		s.l.Error().Err(err).Msg("failed to extract request ID")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	id := callerID(ctx)
+	l := s.l.With().Str("requestID", reqId).Int64("userId", id).Logger()
+	l.Info().Msg("beginning totp enrollment")
+	e, err := s.auth.BeginTOTPEnrollment(ctx, id)
+	if err != nil {
+		if errors.Is(err, auth.ErrMFAUnavailable) {
+			l.Warn().Msg("mfa is not configured")
+			return nil, status.Error(codes.FailedPrecondition, "mfa is not configured")
+		}
+		if errors.Is(err, auth.ErrMFAAlreadyEnabled) {
+			l.Info().Msg("mfa is already enabled")
+			return nil, status.Error(codes.FailedPrecondition, "mfa is already enabled")
+		}
+		if errors.Is(err, auth.ErrUserDoesNotExist) {
+			l.Info().Msg("user does not exist")
+			return nil, status.Error(codes.FailedPrecondition, "user does not exist")
+		}
+		l.Error().Stack().Err(err).Msg("failed to begin totp enrollment")
+		return nil, status.Error(codes.Internal, "failed to begin totp enrollment")
+	}
+	l.Info().Msg("began totp enrollment successfully")
+	return &authv1.BeginTOTPEnrollmentResponse{Secret: e.Secret, Uri: e.URI}, nil
+}
+
+func (s *server) ConfirmTOTPEnrollment(ctx context.Context, in *authv1.ConfirmTOTPEnrollmentRequest) (*authv1.ConfirmTOTPEnrollmentResponse, error) {
+	reqId, err := requestID(ctx)
+	if err != nil {
+		s.l.Error().Err(err).Msg("failed to extract request ID")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	id := callerID(ctx)
+	l := s.l.With().Str("requestID", reqId).Int64("userId", id).Logger()
+	l.Info().Msg("confirming totp enrollment")
+	recoveryCodes, err := s.auth.ConfirmTOTPEnrollment(ctx, id, in.GetCode())
+	if err != nil {
+		if errors.Is(err, auth.ErrMFAUnavailable) {
+			l.Warn().Msg("mfa is not configured")
+			return nil, status.Error(codes.FailedPrecondition, "mfa is not configured")
+		}
+		if errors.Is(err, auth.ErrMFAAlreadyEnabled) {
+			l.Info().Msg("mfa is already enabled")
+			return nil, status.Error(codes.FailedPrecondition, "mfa is already enabled")
+		}
+		if errors.Is(err, auth.ErrNoTOTPEnrollment) {
+			l.Info().Msg("no pending totp enrollment")
+			return nil, status.Error(codes.FailedPrecondition, "no pending totp enrollment")
+		}
+		if errors.Is(err, auth.ErrInvalidMFACode) {
+			l.Info().Msg("invalid totp code")
+			return nil, status.Error(codes.InvalidArgument, "invalid totp code")
+		}
+		l.Error().Stack().Err(err).Msg("failed to confirm totp enrollment")
+		return nil, status.Error(codes.Internal, "failed to confirm totp enrollment")
+	}
+	l.Info().Msg("confirmed totp enrollment successfully")
+	return &authv1.ConfirmTOTPEnrollmentResponse{RecoveryCodes: recoveryCodes}, nil
+}
+
+func (s *server) VerifyMFA(ctx context.Context, in *authv1.VerifyMFARequest) (*authv1.VerifyMFAResponse, error) {
+	reqId, err := requestID(ctx)
+	if err != nil {
+		s.l.Error().Err(err).Msg("failed to extract request ID")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	l := s.l.With().Str("requestID", reqId).Logger()
+	l.Info().Msg("verifying mfa")
+	tokenPair, err := s.auth.VerifyMFA(ctx, in.GetMfaToken(), in.GetCode())
+	if err != nil {
+		var lockedErr *auth.LoginLockedError
+		if errors.As(err, &lockedErr) {
+			l.Info().Time("lockedUntil", lockedErr.Until).Msg("login is locked")
+			return nil, loginLockedStatus(lockedErr)
+		}
+		if errors.Is(err, auth.ErrInvalidMFAToken) {
+			l.Info().Msg("invalid mfa token")
+			return nil, status.Error(codes.InvalidArgument, "invalid mfa token")
+		}
+		if errors.Is(err, auth.ErrInvalidMFACode) {
+			l.Info().Msg("invalid mfa code")
+			return nil, status.Error(codes.InvalidArgument, "invalid mfa code")
+		}
+		if errors.Is(err, auth.ErrUserUnableToLogIn) {
+			l.Info().Msg("user is deleted or banned")
+			return nil, status.Error(codes.FailedPrecondition, "user is deleted or banned")
+		}
+		l.Error().Stack().Err(err).Msg("failed to verify mfa")
+		return nil, status.Error(codes.Internal, "failed to verify mfa")
+	}
+	l.Info().Msg("verified mfa successfully")
+	return &authv1.VerifyMFAResponse{
+		AccessToken:  tokenPair.AccessToken,
+		RefreshToken: tokenPair.RefreshToken,
+	}, nil
+}
+
+func (s *server) BeginWebAuthnRegistration(ctx context.Context, _ *authv1.BeginWebAuthnRegistrationRequest) (*authv1.BeginWebAuthnRegistrationResponse, error) {
+	reqId, err := requestID(ctx)
+	if err != nil {
+		s.l.Error().Err(err).Msg("failed to extract request ID")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	id := callerID(ctx)
+	l := s.l.With().Str("requestID", reqId).Int64("userId", id).Logger()
+	l.Info().Msg("beginning webauthn registration")
+	c, err := s.auth.BeginWebAuthnRegistration(ctx, id)
+	if err != nil {
+		if errors.Is(err, auth.ErrWebAuthnUnavailable) {
+			l.Warn().Msg("webauthn is not configured")
+			return nil, status.Error(codes.FailedPrecondition, "webauthn is not configured")
+		}
+		if errors.Is(err, auth.ErrUserDoesNotExist) {
+			l.Info().Msg("user does not exist")
+			return nil, status.Error(codes.FailedPrecondition, "user does not exist")
+		}
+		l.Error().Stack().Err(err).Msg("failed to begin webauthn registration")
+		return nil, status.Error(codes.Internal, "failed to begin webauthn registration")
+	}
+	l.Info().Msg("began webauthn registration successfully")
+	return &authv1.BeginWebAuthnRegistrationResponse{SessionToken: c.SessionToken, Options: c.Options}, nil
+}
+
+func (s *server) FinishWebAuthnRegistration(ctx context.Context, in *authv1.FinishWebAuthnRegistrationRequest) (*authv1.FinishWebAuthnRegistrationResponse, error) {
+	reqId, err := requestID(ctx)
+	if err != nil {
+		s.l.Error().Err(err).Msg("failed to extract request ID")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	id := callerID(ctx)
+	l := s.l.With().Str("requestID", reqId).Int64("userId", id).Logger()
+	l.Info().Msg("finishing webauthn registration")
+	c, err := s.auth.FinishWebAuthnRegistration(ctx, id, in.GetSessionToken(), in.GetName(), in.GetCredential())
+	if err != nil {
+		if errors.Is(err, auth.ErrWebAuthnUnavailable) {
+			l.Warn().Msg("webauthn is not configured")
+			return nil, status.Error(codes.FailedPrecondition, "webauthn is not configured")
+		}
+		if errors.Is(err, auth.ErrInvalidCredentialName) {
+			l.Info().Msg("credential name is too long")
+			return nil, status.Error(codes.InvalidArgument, "credential name is too long")
+		}
+		if errors.Is(err, auth.ErrInvalidWebAuthnSession) {
+			l.Info().Msg("invalid webauthn session")
+			return nil, status.Error(codes.InvalidArgument, "invalid webauthn session")
+		}
+		if errors.Is(err, auth.ErrInvalidWebAuthnResponse) {
+			l.Info().Msg("invalid webauthn credential")
+			return nil, status.Error(codes.InvalidArgument, "invalid webauthn credential")
+		}
+		if errors.Is(err, auth.ErrWebAuthnCredentialExists) {
+			l.Info().Msg("webauthn credential is already registered")
+			return nil, status.Error(codes.FailedPrecondition, "webauthn credential is already registered")
+		}
+		if errors.Is(err, auth.ErrUserDoesNotExist) {
+			l.Info().Msg("user does not exist")
+			return nil, status.Error(codes.FailedPrecondition, "user does not exist")
+		}
+		l.Error().Stack().Err(err).Msg("failed to finish webauthn registration")
+		return nil, status.Error(codes.Internal, "failed to finish webauthn registration")
+	}
+	l.Info().Int64("credentialId", c.Id).Msg("registered webauthn credential successfully")
+	return &authv1.FinishWebAuthnRegistrationResponse{
+		CredentialId: base64.RawURLEncoding.EncodeToString(c.CredentialId),
+	}, nil
+}
+
+func (s *server) BeginWebAuthnLogin(ctx context.Context, in *authv1.BeginWebAuthnLoginRequest) (*authv1.BeginWebAuthnLoginResponse, error) {
+	reqId, err := requestID(ctx)
+	if err != nil {
+		s.l.Error().Err(err).Msg("failed to extract request ID")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	l := s.l.With().Str("requestID", reqId).Str("email", in.GetEmail()).Logger()
+	l.Info().Msg("beginning webauthn login")
+	c, err := s.auth.BeginWebAuthnLogin(ctx, in.GetEmail())
+	if err != nil {
+		if errors.Is(err, auth.ErrWebAuthnUnavailable) {
+			l.Warn().Msg("webauthn is not configured")
+			return nil, status.Error(codes.FailedPrecondition, "webauthn is not configured")
+		}
+		l.Error().Stack().Err(err).Msg("failed to begin webauthn login")
+		return nil, status.Error(codes.Internal, "failed to begin webauthn login")
+	}
+	l.Info().Msg("began webauthn login successfully")
+	return &authv1.BeginWebAuthnLoginResponse{SessionToken: c.SessionToken, Options: c.Options}, nil
+}
+
+func (s *server) FinishWebAuthnLogin(ctx context.Context, in *authv1.FinishWebAuthnLoginRequest) (*authv1.FinishWebAuthnLoginResponse, error) {
+	reqId, err := requestID(ctx)
+	if err != nil {
+		s.l.Error().Err(err).Msg("failed to extract request ID")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	l := s.l.With().Str("requestID", reqId).Logger()
+	l.Info().Msg("finishing webauthn login")
+	tokenPair, err := s.auth.FinishWebAuthnLogin(ctx, in.GetSessionToken(), in.GetCredential())
+	if err != nil {
+		var lockedErr *auth.LoginLockedError
+		if errors.As(err, &lockedErr) {
+			l.Info().Time("lockedUntil", lockedErr.Until).Msg("login is locked")
+			return nil, loginLockedStatus(lockedErr)
+		}
+		if errors.Is(err, auth.ErrWebAuthnUnavailable) {
+			l.Warn().Msg("webauthn is not configured")
+			return nil, status.Error(codes.FailedPrecondition, "webauthn is not configured")
+		}
+		if errors.Is(err, auth.ErrInvalidWebAuthnSession) {
+			l.Info().Msg("invalid webauthn session")
+			return nil, status.Error(codes.InvalidArgument, "invalid webauthn session")
+		}
+		if errors.Is(err, auth.ErrInvalidWebAuthnResponse) {
+			l.Info().Msg("invalid webauthn assertion")
+			return nil, status.Error(codes.InvalidArgument, "invalid webauthn assertion")
+		}
+		if errors.Is(err, auth.ErrUserUnableToLogIn) {
+			l.Info().Msg("user is deleted or banned")
+			return nil, status.Error(codes.FailedPrecondition, "user is deleted or banned")
+		}
+		if errors.Is(err, auth.ErrEmailNotVerified) {
+			l.Info().Msg("email is not verified")
+			return nil, status.Error(codes.FailedPrecondition, "email is not verified")
+		}
+		l.Error().Stack().Err(err).Msg("failed to finish webauthn login")
+		return nil, status.Error(codes.Internal, "failed to finish webauthn login")
+	}
+	l.Info().Msg("logged in user with webauthn successfully")
+	return &authv1.FinishWebAuthnLoginResponse{
+		AccessToken:  tokenPair.AccessToken,
+		RefreshToken: tokenPair.RefreshToken,
+	}, nil
+}
+
+func (s *server) StartEmailLogin(ctx context.Context, in *authv1.StartEmailLoginRequest) (*authv1.StartEmailLoginResponse, error) {
+	reqId, err := requestID(ctx)
+	if err != nil {
+		s.l.Error().Err(err).Msg("failed to extract request ID")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	l := s.l.With().Str("requestID", reqId).Str("email", in.GetEmail()).Logger()
+	l.Info().Msg("starting email login")
+	err = s.auth.StartEmailLogin(ctx, in.GetEmail())
+	if err != nil {
+		if errors.Is(err, auth.ErrTooManyEmailLoginRequests) {
+			l.Info().Msg("too many email login requests")
+			return nil, status.Error(codes.ResourceExhausted, "too many email login requests")
+		}
+		l.Error().Stack().Err(err).Msg("failed to start email login")
+		return nil, status.Error(codes.Internal, "failed to start email login")
+	}
+	l.Info().Msg("started email login successfully")
+	return &authv1.StartEmailLoginResponse{}, nil
+}
+
+func (s *server) CompleteEmailLogin(ctx context.Context, in *authv1.CompleteEmailLoginRequest) (*authv1.CompleteEmailLoginResponse, error) {
+	reqId, err := requestID(ctx)
+	if err != nil {
+		s.l.Error().Err(err).Msg("failed to extract request ID")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	l := s.l.With().Str("requestID", reqId).Logger()
+	l.Info().Msg("completing email login")
+	res, err := s.auth.CompleteEmailLogin(ctx, in.GetToken())
+	if err != nil {
+		var lockedErr *auth.LoginLockedError
+		if errors.As(err, &lockedErr) {
+			l.Info().Time("lockedUntil", lockedErr.Until).Msg("login is locked")
+			return nil, loginLockedStatus(lockedErr)
+		}
+		if errors.Is(err, auth.ErrInvalidEmailLoginToken) {
+			l.Info().Msg("invalid email login token")
+			return nil, status.Error(codes.InvalidArgument, "invalid email login token")
+		}
+		if errors.Is(err, auth.ErrUserUnableToLogIn) {
+			l.Info().Msg("user is deleted or banned")
+			return nil, status.Error(codes.FailedPrecondition, "user is deleted or banned")
+		}
+		l.Error().Stack().Err(err).Msg("failed to complete email login")
+		return nil, status.Error(codes.Internal, "failed to complete email login")
+	}
+	if res.MFAToken != "" {
+		l.Info().Msg("mfa required to log in user")
+		return &authv1.CompleteEmailLoginResponse{MfaToken: res.MFAToken}, nil
+	}
+	l.Info().Msg("logged in user with email successfully")
+	return &authv1.CompleteEmailLoginResponse{
+		AccessToken:  res.Tokens.AccessToken,
+		RefreshToken: res.Tokens.RefreshToken,
+	}, nil
+}
+
+func (s *server) CreateOAuthClient(ctx context.Context, in *authv1.CreateOAuthClientRequest) (*authv1.CreateOAuthClientResponse, error) {
+	reqId, err := requestID(ctx)
+	if err != nil {
+		s.l.Error().Err(err).Msg("failed to extract request ID")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	l := s.l.With().Str("requestID", reqId).Int64("callerId", callerID(ctx)).Str("name", in.GetName()).Logger()
+	l.Info().Msg("creating oauth client")
+	c, secret, err := s.auth.CreateOAuthClient(ctx, in.GetName(), in.GetRedirectUris(), in.GetPublic())
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidClientName) || errors.Is(err, auth.ErrInvalidRedirectURI) {
+			l.Info().Err(err).Msg("invalid create oauth client request")
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		l.Error().Stack().Err(err).Msg("failed to create oauth client")
+		return nil, status.Error(codes.Internal, "failed to create oauth client")
+	}
+	l.Info().Str("clientId", c.ClientId).Msg("created oauth client successfully")
+	return &authv1.CreateOAuthClientResponse{Client: toProtoOAuthClient(c), ClientSecret: secret}, nil
+}
+
+func (s *server) ListOAuthClients(ctx context.Context, _ *authv1.ListOAuthClientsRequest) (*authv1.ListOAuthClientsResponse, error) {
+	reqId, err := requestID(ctx)
+	if err != nil {
+		s.l.Error().Err(err).Msg("failed to extract request ID")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	l := s.l.With().Str("requestID", reqId).Int64("callerId", callerID(ctx)).Logger()
+	l.Info().Msg("listing oauth clients")
+	clients, err := s.auth.ListOAuthClients(ctx)
+	if err != nil {
+		l.Error().Stack().Err(err).Msg("failed to list oauth clients")
+		return nil, status.Error(codes.Internal, "failed to list oauth clients")
+	}
+	l.Info().Int("count", len(clients)).Msg("listed oauth clients successfully")
+	resp := &authv1.ListOAuthClientsResponse{Clients: make([]*authv1.OAuthClient, 0, len(clients))}
+	for _, c := range clients {
+		resp.Clients = append(resp.Clients, toProtoOAuthClient(c))
+	}
+	return resp, nil
+}
+
+func (s *server) DeleteOAuthClient(ctx context.Context, in *authv1.DeleteOAuthClientRequest) (*authv1.DeleteOAuthClientResponse, error) {
+	reqId, err := requestID(ctx)
+	if err != nil {
+		s.l.Error().Err(err).Msg("failed to extract request ID")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	l := s.l.With().Str("requestID", reqId).Int64("callerId", callerID(ctx)).Str("clientId", in.GetClientId()).Logger()
+	l.Info().Msg("deleting oauth client")
+	err = s.auth.DeleteOAuthClient(ctx, in.GetClientId())
+	if err != nil {
+		if errors.Is(err, auth.ErrOAuthClientDoesNotExist) {
+			l.Info().Msg("oauth client does not exist")
+			return nil, status.Error(codes.NotFound, "oauth client does not exist")
+		}
+		l.Error().Stack().Err(err).Msg("failed to delete oauth client")
+		return nil, status.Error(codes.Internal, "failed to delete oauth client")
+	}
+	l.Info().Msg("deleted oauth client successfully")
+	return &authv1.DeleteOAuthClientResponse{}, nil
+}
+
+func (s *server) CreateServiceAccount(ctx context.Context, in *authv1.CreateServiceAccountRequest) (*authv1.CreateServiceAccountResponse, error) {
+	reqId, err := requestID(ctx)
+	if err != nil {
+		s.l.Error().Err(err).Msg("failed to extract request ID")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	l := s.l.With().Str("requestID", reqId).Int64("callerId", callerID(ctx)).Str("name", in.GetName()).Logger()
+	l.Info().Msg("creating service account")
+	sa, secret, err := s.auth.CreateServiceAccount(ctx, in.GetName(), in.GetScopes())
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidServiceAccountName) || errors.Is(err, auth.ErrInvalidServiceScope) {
+			l.Info().Err(err).Msg("invalid create service account request")
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if errors.Is(err, auth.ErrScopeNotHeld) {
+			l.Info().Msg("caller does not hold the permission of a scope")
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		l.Error().Stack().Err(err).Msg("failed to create service account")
+		return nil, status.Error(codes.Internal, "failed to create service account")
+	}
+	l.Info().Str("clientId", sa.ClientId).Msg("created service account successfully")
+	return &authv1.CreateServiceAccountResponse{ServiceAccount: toProtoServiceAccount(sa), ClientSecret: secret}, nil
+}
+
+func (s *server) ListServiceAccounts(ctx context.Context, _ *authv1.ListServiceAccountsRequest) (*authv1.ListServiceAccountsResponse, error) {
+	reqId, err := requestID(ctx)
+	if err != nil {
+		s.l.Error().Err(err).Msg("failed to extract request ID")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	l := s.l.With().Str("requestID", reqId).Int64("callerId", callerID(ctx)).Logger()
+	l.Info().Msg("listing service accounts")
+	accounts, err := s.auth.ListServiceAccounts(ctx)
+	if err != nil {
+		l.Error().Stack().Err(err).Msg("failed to list service accounts")
+		return nil, status.Error(codes.Internal, "failed to list service accounts")
+	}
+	l.Info().Int("count", len(accounts)).Msg("listed service accounts successfully")
+	resp := &authv1.ListServiceAccountsResponse{ServiceAccounts: make([]*authv1.ServiceAccount, 0, len(accounts))}
+	for _, sa := range accounts {
+		resp.ServiceAccounts = append(resp.ServiceAccounts, toProtoServiceAccount(sa))
+	}
+	return resp, nil
+}
+
+func (s *server) RotateServiceAccountSecret(ctx context.Context, in *authv1.RotateServiceAccountSecretRequest) (*authv1.RotateServiceAccountSecretResponse, error) {
+	reqId, err := requestID(ctx)
+	if err != nil {
+		s.l.Error().Err(err).Msg("failed to extract request ID")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	l := s.l.With().Str("requestID", reqId).Int64("callerId", callerID(ctx)).Str("clientId", in.GetClientId()).Logger()
+	l.Info().Msg("rotating service account secret")
+	secret, err := s.auth.RotateServiceAccountSecret(ctx, in.GetClientId())
+	if err != nil {
+		if errors.Is(err, auth.ErrServiceAccountDoesNotExist) {
+			l.Info().Msg("service account does not exist")
+			return nil, status.Error(codes.NotFound, "service account does not exist")
+		}
+		if errors.Is(err, auth.ErrServiceAccountDisabled) {
+			l.Info().Msg("service account is disabled")
+			return nil, status.Error(codes.FailedPrecondition, "service account is disabled")
+		}
+		l.Error().Stack().Err(err).Msg("failed to rotate service account secret")
+		return nil, status.Error(codes.Internal, "failed to rotate service account secret")
+	}
+	l.Info().Msg("rotated service account secret successfully")
+	return &authv1.RotateServiceAccountSecretResponse{ClientSecret: secret}, nil
+}
+
+func (s *server) DisableServiceAccount(ctx context.Context, in *authv1.DisableServiceAccountRequest) (*authv1.DisableServiceAccountResponse, error) {
+	reqId, err := requestID(ctx)
+	if err != nil {
+		s.l.Error().Err(err).Msg("failed to extract request ID")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	l := s.l.With().Str("requestID", reqId).Int64("callerId", callerID(ctx)).Str("clientId", in.GetClientId()).Logger()
+	l.Info().Msg("disabling service account")
+	err = s.auth.DisableServiceAccount(ctx, in.GetClientId())
+	if err != nil {
+		if errors.Is(err, auth.ErrServiceAccountDoesNotExist) {
+			l.Info().Msg("service account does not exist")
+			return nil, status.Error(codes.NotFound, "service account does not exist")
+		}
+		l.Error().Stack().Err(err).Msg("failed to disable service account")
+		return nil, status.Error(codes.Internal, "failed to disable service account")
+	}
+	l.Info().Msg("disabled service account successfully")
+	return &authv1.DisableServiceAccountResponse{}, nil
+}
+
+func (s *server) IssueServiceToken(ctx context.Context, in *authv1.IssueServiceTokenRequest) (*authv1.IssueServiceTokenResponse, error) {
+	reqId, err := requestID(ctx)
+	if err != nil {
+		s.l.Error().Err(err).Msg("failed to extract request ID")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	l := s.l.With().Str("requestID", reqId).Str("clientId", in.GetClientId()).Logger()
+	l.Info().Msg("issuing service token")
+	token, err := s.auth.IssueServiceToken(ctx, in.GetClientId(), in.GetClientSecret(), in.GetScope())
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidServiceCredentials) {
+			l.Info().Msg("invalid service account credentials")
+			return nil, status.Error(codes.Unauthenticated, "invalid service account credentials")
+		}
+		if errors.Is(err, auth.ErrScopeNotGranted) {
+			l.Info().Str("scope", in.GetScope()).Msg("scope not granted")
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		if errors.Is(err, auth.ErrSecretJustRotated) {
+			l.Info().Msg("secret was just rotated")
+			return nil, status.Error(codes.Unavailable, "secret was just rotated, retry in a second")
+		}
+		l.Error().Stack().Err(err).Msg("failed to issue service token")
+		return nil, status.Error(codes.Internal, "failed to issue service token")
+	}
+	l.Info().Msg("issued service token successfully")
+	return &authv1.IssueServiceTokenResponse{
+		AccessToken: token.AccessToken,
+		ExpiresAt:   timestamppb.New(token.ExpiresAt),
+		Scope:       token.Scope,
+	}, nil
+}
+
+func (s *server) permissionChangeError(l zerolog.Logger, err error, msg string) error {
+	if errors.Is(err, auth.ErrUnknownPermission) {
+		l.Info().Msg("unknown permission")
+		return status.Error(codes.InvalidArgument, "unknown permission")
+	}
+	if errors.Is(err, auth.ErrRoleDoesNotExist) {
+		l.Info().Msg("role does not exist")
+		return status.Error(codes.FailedPrecondition, "role does not exist")
+	}
+	if errors.Is(err, auth.ErrPermissionNotHeld) {
+		l.Info().Msg("caller does not hold the permission")
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	l.Error().Stack().Err(err).Msg(msg)
+	return status.Error(codes.Internal, msg)
+}
+
+func (s *server) AssignRole(ctx context.Context, in *authv1.AssignRoleRequest) (*authv1.AssignRoleResponse, error) {
+	reqId, err := requestID(ctx)
+	if err != nil {
+		s.l.Error().Err(err).Msg("failed to extract request ID")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	l := s.l.With().Str("requestID", reqId).Int64("callerId", callerID(ctx)).Int64("userId", in.GetUserId()).Str("role", in.GetRole()).Logger()
+	l.Info().Msg("assigning role")
+	err = s.auth.AssignRole(ctx, in.GetUserId(), in.GetRole())
+	if err != nil {
+		return nil, s.roleChangeError(l, err, "failed to assign role")
+	}
+	l.Info().Msg("assigned role successfully")
+	return &authv1.AssignRoleResponse{}, nil
+}
+
+func (s *server) UnassignRole(ctx context.Context, in *authv1.UnassignRoleRequest) (*authv1.UnassignRoleResponse, error) {
+	reqId, err := requestID(ctx)
+	if err != nil {
+		s.l.Error().Err(err).Msg("failed to extract request ID")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	l := s.l.With().Str("requestID", reqId).Int64("callerId", callerID(ctx)).Int64("userId", in.GetUserId()).Str("role", in.GetRole()).Logger()
+	l.Info().Msg("unassigning role")
+	err = s.auth.UnassignRole(ctx, in.GetUserId(), in.GetRole())
+	if err != nil {
+		return nil, s.roleChangeError(l, err, "failed to unassign role")
+	}
+	l.Info().Msg("unassigned role successfully")
+	return &authv1.UnassignRoleResponse{}, nil
+}
+
+func (s *server) roleChangeError(l zerolog.Logger, err error, msg string) error {
+	if errors.Is(err, auth.ErrUserDoesNotExist) {
+		l.Info().Msg("user does not exist")
+		return status.Error(codes.FailedPrecondition, "user does not exist")
+	}
+	if errors.Is(err, auth.ErrRoleDoesNotExist) {
+		l.Info().Msg("role does not exist")
+		return status.Error(codes.FailedPrecondition, "role does not exist")
+	}
+	if errors.Is(err, auth.ErrPermissionNotHeld) {
+		l.Info().Msg("caller does not hold a permission of the role")
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	l.Error().Stack().Err(err).Msg(msg)
+	return status.Error(codes.Internal, msg)
+}
+
+// preconditionStatus returns a FailedPrecondition error with a violation
+// of typ clients can tell the failures apart by.
+func preconditionStatus(typ string, description string) error {
+	st, err := status.New(codes.FailedPrecondition, description).WithDetails(&errdetails.PreconditionFailure{
+		Violations: []*errdetails.PreconditionFailure_Violation{{Type: typ, Description: description}},
+	})
+	if err != nil {
+		return status.Error(codes.FailedPrecondition, description)
+	}
+	return st.Err()
+}
+
+// passwordPolicyStatus reports every broken password rule as a field
+// violation of field.
+func passwordPolicyStatus(field string, e *auth.PasswordPolicyError) error {
+	br := &errdetails.BadRequest{}
+	for _, v := range e.Violations {
+		br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       field,
+			Description: v.Rule + ": " + v.Description,
+		})
+	}
+	st, err := status.New(codes.InvalidArgument, "password violates policy").WithDetails(br)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "password violates policy")
+	}
+	return st.Err()
+}
+
+// loginLockedStatus tells clients apart from invalid credentials by the
+// LOGIN_LOCKED reason and when to try again.
+func loginLockedStatus(e *auth.LoginLockedError) error {
+	st, err := status.New(codes.ResourceExhausted, "too many failed logins").WithDetails(
+		&errdetails.ErrorInfo{Reason: "LOGIN_LOCKED", Domain: errorDomain},
+		&errdetails.RetryInfo{RetryDelay: durationpb.New(time.Until(e.Until).Round(time.Second))},
+	)
+	if err != nil {
+		return status.Error(codes.ResourceExhausted, "too many failed logins")
+	}
+	return st.Err()
+}
+
+func toProtoRole(r *models.Role) *authv1.Role {
+	return &authv1.Role{
+		Name:        r.Name,
+		Permissions: r.Permissions,
+		CreatedAt:   timestamppb.New(r.CreatedAt),
+	}
+}
+
+func toProtoOAuthClient(c *models.OAuthClient) *authv1.OAuthClient {
+	return &authv1.OAuthClient{
+		ClientId:     c.ClientId,
+		Name:         c.Name,
+		RedirectUris: c.RedirectURIs,
+		Public:       c.Public(),
+		CreatedAt:    timestamppb.New(c.CreatedAt),
+	}
+}
+
+func toProtoServiceAccount(sa *models.ServiceAccount) *authv1.ServiceAccount {
+	psa := &authv1.ServiceAccount{
+		ClientId:  sa.ClientId,
+		Name:      sa.Name,
+		Scopes:    sa.Scopes,
+		CreatedAt: timestamppb.New(sa.CreatedAt),
+	}
+	if sa.SecretRotatedAt != nil {
+		psa.SecretRotatedAt = timestamppb.New(*sa.SecretRotatedAt)
+	}
+	if sa.DisabledAt != nil {
+		psa.DisabledAt = timestamppb.New(*sa.DisabledAt)
+	}
+	return psa
+}
+
+func toProtoUser(u *models.User) *authv1.User {
+	pu := &authv1.User{
+		Id:        u.Id,
+		Email:     u.Email,
+		CreatedAt: timestamppb.New(u.CreatedAt),
+		IsBanned:  u.IsBanned,
+		IsDeleted: u.IsDeleted,
+		IsAdmin:   u.IsAdmin,
+	}
+	if u.EmailVerifiedAt != nil {
+		pu.EmailVerifiedAt = timestamppb.New(*u.EmailVerifiedAt)
+	}
+	return pu
+}
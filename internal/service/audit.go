@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/vindosVP/snauth/internal/models"
+	"github.com/vindosVP/snauth/internal/reqctx"
+)
+
+type AuditStorage interface {
+	SaveAuditEvent(ctx context.Context, e *models.AuditEvent) error
+	ListAuditEvents(ctx context.Context, filter models.AuditFilter, beforeId int64, limit int) ([]*models.AuditEvent, error)
+}
+
+// ListAuditEvents returns one page of events matching the filter, newest first.
+func (a *Auth) ListAuditEvents(ctx context.Context, q models.ListAuditEventsQuery) (*models.AuditEventList, error) {
+	var beforeId int64
+	if q.PageToken != "" {
+		// Events are always sorted by id, so the token carries no sort field.
+		before, err := decodePageToken(q.PageToken, "")
+		if err != nil {
+			return nil, err
+		}
+		beforeId = before.Id
+	}
+	limit := pageSize(q.PageSize)
+	// One extra event tells whether there is a next page.
+	events, err := a.as.ListAuditEvents(ctx, q.Filter, beforeId, limit+1)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list audit events")
+	}
+	list := &models.AuditEventList{Events: events}
+	if len(events) == limit+1 {
+		list.Events = events[:limit]
+		list.NextPageToken = encodePageToken(pageToken{Id: list.Events[limit-1].Id})
+	}
+	return list, nil
+}
+
+// audit records an event of typ on the target user. The actor is the
+// authenticated user or service account, or the target itself for
+// anonymous calls like Login.
+func (a *Auth) audit(ctx context.Context, typ string, targetId int64, details string) error {
+	e := &models.AuditEvent{
+		Type:      typ,
+		ActorId:   targetId,
+		TargetId:  targetId,
+		IP:        reqctx.ClientIP(ctx),
+		RequestId: reqctx.RequestID(ctx),
+		Details:   details,
+	}
+	if c, ok := reqctx.CallerFromContext(ctx); ok {
+		e.ActorId = c.Id
+		e.ActorServiceAccount = c.ServiceAccount
+	}
+	return a.as.SaveAuditEvent(ctx, e)
+}
@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/vindosVP/snauth/internal/models"
+	"github.com/vindosVP/snauth/internal/reqctx"
+	"github.com/vindosVP/snauth/internal/storage"
+)
+
+// StartEmailLogin sends a single-use login token to the user. Unknown,
+// banned and deleted accounts are silently skipped. At most
+// EmailLoginLimit requests are accepted per email and EmailLoginWindow,
+// whether an account exists or not, so the limit reveals nothing.
+func (a *Auth) StartEmailLogin(ctx context.Context, email string) error {
+	limited, err := a.requestLimited(ctx, "email_login:"+strings.ToLower(strings.TrimSpace(email)), a.cfg.EmailLoginLimit, a.cfg.EmailLoginWindow)
+	if err != nil {
+		return err
+	}
+	if limited {
+		return ErrTooManyEmailLoginRequests
+	}
+	u, err := a.us.UserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserDoesNotExist) {
+			return nil
+		}
+		return errors.Wrap(err, "failed to get user by email")
+	}
+	if u.IsBanned || u.IsDeleted {
+		return nil
+	}
+	token, err := a.issueOneTimeToken(ctx, u.Id, models.TokenPurposeEmailLogin, a.cfg.EmailLoginTTL)
+	if err != nil {
+		return err
+	}
+	err = a.n.Notify(ctx, models.Message{
+		To:      u.Email,
+		Subject: "Sign in",
+		Body:    tokenBody("sign in", a.cfg.EmailLoginURL, token),
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to send email login token")
+	}
+	return nil
+}
+
+// CompleteEmailLogin consumes the login token. Receiving it proves the
+// user owns the email, so the email is marked verified. Users with MFA
+// enabled still have to pass it like after Login.
+//
+// An unverified account may have been registered by someone else before
+// the owner of the email. With EmailLoginClaimsAccount set, verifying it
+// this way replaces the password, removes every second factor and ends
+// every session. Otherwise unverified accounts are legitimate and keep
+// their credentials.
+func (a *Auth) CompleteEmailLogin(ctx context.Context, token string) (*models.LoginResult, error) {
+	if ip := reqctx.ClientIP(ctx); ip != "" {
+		if err := a.checkLoginLock(ctx, ipThrottleKey(ip)); err != nil {
+			return nil, a.loginRejected(ctx, 0, "client address is locked", err)
+		}
+	}
+	t, err := a.ts.UseOneTimeToken(ctx, models.TokenPurposeEmailLogin, hashToken(token))
+	if err != nil {
+		if errors.Is(err, storage.ErrOneTimeTokenInvalid) {
+			if err := a.loginFailed(ctx, nil); err != nil {
+				return nil, err
+			}
+			return nil, a.loginRejected(ctx, 0, "invalid email login token", ErrInvalidEmailLoginToken)
+		}
+		return nil, errors.Wrap(err, "failed to use email login token")
+	}
+	u, err := a.us.UserByID(ctx, t.UserId)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserDoesNotExist) {
+			return nil, ErrInvalidEmailLoginToken
+		}
+		return nil, errors.Wrap(err, "failed to get user by id")
+	}
+	err = a.ts.InvalidateOneTimeTokens(ctx, u.Id, models.TokenPurposeEmailLogin)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to invalidate email login tokens")
+	}
+	if u.IsBanned || u.IsDeleted {
+		return nil, a.loginRejected(ctx, u.Id, "user is deleted or banned", ErrUserUnableToLogIn)
+	}
+	if u.EmailVerifiedAt == nil {
+		if err := a.verifyEmailLogin(ctx, u); err != nil {
+			return nil, err
+		}
+	}
+	return a.completeLogin(ctx, u, "email")
+}
+
+// verifyEmailLogin marks the email of the user verified, claiming the
+// account if configured.
+func (a *Auth) verifyEmailLogin(ctx context.Context, u *models.User) error {
+	if a.cfg.EmailLoginClaimsAccount {
+		return a.claimAccount(ctx, u)
+	}
+	now := time.Now()
+	err := a.us.SetEmailVerified(ctx, u.Id, now)
+	if err != nil {
+		return errors.Wrap(err, "failed to set email verified")
+	}
+	u.EmailVerifiedAt = &now
+	return nil
+}
+
+// claimAccount verifies the email of the user and drops every credential
+// set before. The new password is random, the user can set one with a
+// password reset.
+func (a *Auth) claimAccount(ctx context.Context, u *models.User) error {
+	secret, err := randomToken()
+	if err != nil {
+		return errors.Wrap(err, "failed to generate password")
+	}
+	hPassword, err := a.ph.Hash(secret)
+	if err != nil {
+		return errors.Wrap(err, "failed to hash password")
+	}
+	now := time.Now()
+	err = a.us.ClaimAccount(ctx, u.Id, hPassword, now)
+	if err != nil {
+		return errors.Wrap(err, "failed to claim account")
+	}
+	u.HPassword = string(hPassword)
+	u.EmailVerifiedAt = &now
+	return a.revokeSessions(ctx, u.Id, models.RevocationReasonPassword)
+}
+
+// requestLimited counts a request for the key and reports whether more
+// than limit requests were made without a pause of window.
+func (a *Auth) requestLimited(ctx context.Context, key string, limit int, window time.Duration) (bool, error) {
+	t, err := a.ls.RecordLoginFailure(ctx, key, time.Now().Add(-window))
+	if err != nil {
+		return false, err
+	}
+	return t.Failures > limit, nil
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/vindosVP/snauth/internal/models"
+	"github.com/vindosVP/snauth/internal/password"
+	"github.com/vindosVP/snauth/internal/revocation"
+)
+
+func newEmailLoginTestAuth(s *fakeStorage, claimsAccount bool) *Auth {
+	return New(Deps{
+		Users:          s,
+		Tokens:         s,
+		LoginThrottle:  s,
+		Audit:          s,
+		Roles:          s,
+		MFA:            s,
+		WebAuthn:       s,
+		TokenProvider:  fakeTokenProvider{},
+		Revocations:    revocation.NewBroker(),
+		PasswordHasher: password.Bcrypt{Cost: bcrypt.MinCost},
+	}, Config{
+		LoginMaxFailures:        5,
+		LoginMaxIPFailures:      20,
+		LoginFailureWindow:      time.Hour,
+		LoginLockout:            time.Minute,
+		LoginMaxLockout:         time.Hour,
+		EmailLoginClaimsAccount: claimsAccount,
+	})
+}
+
+// unverifiedAccount stores an account with an unverified email, a
+// password, a passkey and an email login token for it.
+func unverifiedAccount(token string) *fakeStorage {
+	s := newFakeStorage(&models.User{Id: 1, Email: "user@example.com", HPassword: "old hash"})
+	s.credentials = append(s.credentials, &models.WebAuthnCredential{UserId: 1, CredentialId: []byte("passkey")})
+	s.oneTime[hashToken(token)] = &models.OneTimeToken{
+		UserId:    1,
+		Purpose:   models.TokenPurposeEmailLogin,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(time.Minute),
+	}
+	return s
+}
+
+func TestCompleteEmailLoginKeepsCredentials(t *testing.T) {
+	ctx := context.Background()
+	s := unverifiedAccount("token")
+	a := newEmailLoginTestAuth(s, false)
+
+	res, err := a.CompleteEmailLogin(ctx, "token")
+	if err != nil {
+		t.Fatalf("complete email login: %v", err)
+	}
+	if res.Tokens == nil {
+		t.Fatalf("unexpected login result %+v", res)
+	}
+	u := s.users[1]
+	if u.EmailVerifiedAt == nil {
+		t.Fatal("email was not verified")
+	}
+	if u.HPassword != "old hash" || len(s.credentials) != 1 || u.TokensValidAfter != nil {
+		t.Fatal("credentials of an unverified account were dropped")
+	}
+}
+
+func TestCompleteEmailLoginClaimsAccount(t *testing.T) {
+	ctx := context.Background()
+	s := unverifiedAccount("token")
+	s.totp[1] = &models.TOTP{UserId: 1, ConfirmedAt: &time.Time{}}
+	a := newEmailLoginTestAuth(s, true)
+
+	res, err := a.CompleteEmailLogin(ctx, "token")
+	if err != nil {
+		t.Fatalf("complete email login: %v", err)
+	}
+	if res.Tokens == nil {
+		t.Fatalf("unexpected login result %+v", res)
+	}
+	u := s.users[1]
+	if u.EmailVerifiedAt == nil {
+		t.Fatal("email was not verified")
+	}
+	if u.HPassword == "old hash" || len(s.credentials) != 0 || len(s.totp) != 0 {
+		t.Fatal("credentials set before the claim were kept")
+	}
+	if u.TokensValidAfter == nil {
+		t.Fatal("sessions started before the claim were not revoked")
+	}
+}
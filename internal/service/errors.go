@@ -1,11 +1,110 @@
 package auth
 
-import "github.com/pkg/errors"
+import (
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/vindosVP/snauth/internal/models"
+)
 
 var (
 	ErrUserAlreadyExists      = errors.New("user already exists")
 	ErrInvalidLoginOrPassword = errors.New("invalid login or password")
 	ErrInvalidRefreshToken    = errors.New("invalid refresh token")
+	ErrRefreshTokenReused     = errors.New("refresh token reuse detected")
 	ErrUserUnableToLogIn      = errors.New("user is unable to log in")
 	ErrUserDoesNotExist       = errors.New("user does not exist")
+	ErrLastAdmin              = errors.New("no active admin would be left")
+	ErrSelfChangeNotConfirmed = errors.New("changing own account requires confirmation")
+	ErrInvalidPageToken       = errors.New("invalid page token")
+	ErrInvalidSortField       = errors.New("invalid sort field")
+	ErrInvalidResetToken      = errors.New("invalid password reset token")
+	ErrInvalidPassword        = errors.New("invalid password")
+	ErrKeyRotationUnavailable = errors.New("signing key rotation is not configured")
+	ErrKeyRotationPending     = errors.New("the previously rotated signing key is not active yet")
+
+	ErrEmailNotVerified            = errors.New("email is not verified")
+	ErrInvalidVerificationToken    = errors.New("invalid email verification token")
+	ErrTooManyVerificationRequests = errors.New("too many verification requests")
+
+	ErrRoleAlreadyExists = errors.New("role already exists")
+	ErrRoleDoesNotExist  = errors.New("role does not exist")
+	ErrInvalidRoleName   = errors.New("invalid role name")
+	ErrUnknownPermission = errors.New("unknown permission")
+	ErrPermissionNotHeld = errors.New("caller does not hold the permission")
+
+	ErrMFAUnavailable    = errors.New("mfa is not configured")
+	ErrMFAAlreadyEnabled = errors.New("mfa is already enabled")
+	ErrNoTOTPEnrollment  = errors.New("no pending totp enrollment")
+	ErrInvalidMFACode    = errors.New("invalid mfa code")
+	ErrInvalidMFAToken   = errors.New("invalid mfa token")
+
+	ErrWebAuthnUnavailable      = errors.New("webauthn is not configured")
+	ErrInvalidWebAuthnSession   = errors.New("invalid webauthn session")
+	ErrInvalidWebAuthnResponse  = errors.New("invalid webauthn response")
+	ErrWebAuthnCredentialExists = errors.New("webauthn credential is already registered")
+	ErrInvalidCredentialName    = errors.New("credential name is too long")
+
+	ErrInvalidEmailLoginToken    = errors.New("invalid email login token")
+	ErrTooManyEmailLoginRequests = errors.New("too many email login requests")
+
+	ErrTooManyPasswordResetRequests = errors.New("too many password reset requests")
+
+	ErrInvalidClientName       = errors.New("invalid client name")
+	ErrInvalidRedirectURI      = errors.New("invalid redirect uri")
+	ErrOAuthClientDoesNotExist = errors.New("oauth client does not exist")
+	ErrInvalidOAuthClient      = errors.New("invalid oauth client")
+	ErrInvalidScope            = errors.New("openid scope required")
+	ErrInvalidCodeChallenge    = errors.New("S256 code challenge required")
+	ErrLoginRequired           = errors.New("login required")
+	ErrInvalidGrant            = errors.New("invalid grant")
+	ErrInvalidAccessToken      = errors.New("invalid access token")
+
+	ErrInvalidServiceAccountName  = errors.New("invalid service account name")
+	ErrInvalidServiceScope        = errors.New("invalid scope")
+	ErrScopeNotHeld               = errors.New("caller does not hold the permission of the scope")
+	ErrServiceAccountDoesNotExist = errors.New("service account does not exist")
+	ErrServiceAccountDisabled     = errors.New("service account is disabled")
+	ErrInvalidServiceCredentials  = errors.New("invalid service account credentials")
+	ErrScopeNotGranted            = errors.New("scope is not granted to the service account")
+	ErrSecretJustRotated          = errors.New("secret was rotated less than a second ago")
 )
+
+// PasswordPolicyError lists every password policy rule a password breaks.
+type PasswordPolicyError struct {
+	Violations []models.PasswordViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	rules := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		rules = append(rules, v.Rule)
+	}
+	return "password violates policy: " + strings.Join(rules, ", ")
+}
+
+// LoginLockedError is returned while too many failed logins lock the
+// account or the client address.
+type LoginLockedError struct {
+	Until time.Time
+}
+
+func (e *LoginLockedError) Error() string {
+	return "login is locked until " + e.Until.Format(time.RFC3339)
+}
+
+// VerificationNotSentError is returned by Register when the user was
+// created but the verification token could not be sent.
+type VerificationNotSentError struct {
+	Err error
+}
+
+func (e *VerificationNotSentError) Error() string {
+	return "verification not sent: " + e.Err.Error()
+}
+
+func (e *VerificationNotSentError) Unwrap() error {
+	return e.Err
+}
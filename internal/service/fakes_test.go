@@ -0,0 +1,224 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/vindosVP/snauth/internal/models"
+	"github.com/vindosVP/snauth/internal/storage"
+)
+
+// fakeStorage keeps what the tested flows touch in memory. Calls to any
+// other method panic on the nil embedded interfaces.
+type fakeStorage struct {
+	UserStorage
+	TokenStorage
+	RoleStorage
+	AuditStorage
+	MFAStorage
+
+	users       map[int64]*models.User
+	oneTime     map[string]*models.OneTimeToken
+	totp        map[int64]*models.TOTP
+	credentials []*models.WebAuthnCredential
+	sessions    map[string]*models.WebAuthnSession
+	throttles   map[string]*models.LoginThrottle
+	events      []*models.AuditEvent
+	refresh     []*models.RefreshToken
+}
+
+func newFakeStorage(users ...*models.User) *fakeStorage {
+	s := &fakeStorage{
+		users:     make(map[int64]*models.User),
+		oneTime:   make(map[string]*models.OneTimeToken),
+		totp:      make(map[int64]*models.TOTP),
+		sessions:  make(map[string]*models.WebAuthnSession),
+		throttles: make(map[string]*models.LoginThrottle),
+	}
+	for _, u := range users {
+		s.users[u.Id] = u
+	}
+	return s
+}
+
+func (s *fakeStorage) UserByID(_ context.Context, id int64) (*models.User, error) {
+	u, ok := s.users[id]
+	if !ok {
+		return nil, storage.ErrUserDoesNotExist
+	}
+	return u, nil
+}
+
+func (s *fakeStorage) UserByEmail(_ context.Context, email string) (*models.User, error) {
+	for _, u := range s.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return nil, storage.ErrUserDoesNotExist
+}
+
+func (s *fakeStorage) SaveWebAuthnCredential(_ context.Context, c *models.WebAuthnCredential) error {
+	for _, stored := range s.credentials {
+		if bytes.Equal(stored.CredentialId, c.CredentialId) {
+			return storage.ErrWebAuthnCredentialExists
+		}
+	}
+	s.credentials = append(s.credentials, c)
+	return nil
+}
+
+func (s *fakeStorage) WebAuthnCredentials(_ context.Context, userId int64) ([]*models.WebAuthnCredential, error) {
+	var res []*models.WebAuthnCredential
+	for _, c := range s.credentials {
+		if c.UserId == userId {
+			res = append(res, c)
+		}
+	}
+	return res, nil
+}
+
+func (s *fakeStorage) UpdateWebAuthnCredentialUse(_ context.Context, credentialId []byte, signCount uint32, backupState bool) error {
+	for _, c := range s.credentials {
+		if bytes.Equal(c.CredentialId, credentialId) {
+			c.SignCount = signCount
+			c.BackupState = backupState
+			return nil
+		}
+	}
+	return storage.ErrWebAuthnCredentialNotFound
+}
+
+func (s *fakeStorage) SaveWebAuthnSession(_ context.Context, ws *models.WebAuthnSession) error {
+	s.sessions[ws.Ceremony+":"+ws.TokenHash] = ws
+	return nil
+}
+
+func (s *fakeStorage) UseWebAuthnSession(_ context.Context, ceremony string, tokenHash string) (*models.WebAuthnSession, error) {
+	ws, ok := s.sessions[ceremony+":"+tokenHash]
+	if !ok || !ws.ExpiresAt.After(time.Now()) {
+		return nil, storage.ErrWebAuthnSessionInvalid
+	}
+	delete(s.sessions, ceremony+":"+tokenHash)
+	return ws, nil
+}
+
+func (s *fakeStorage) LoginThrottle(_ context.Context, key string) (*models.LoginThrottle, error) {
+	if t, ok := s.throttles[key]; ok {
+		return t, nil
+	}
+	return &models.LoginThrottle{Key: key}, nil
+}
+
+func (s *fakeStorage) RecordLoginFailure(_ context.Context, key string, _ time.Time) (*models.LoginThrottle, error) {
+	t, ok := s.throttles[key]
+	if !ok {
+		t = &models.LoginThrottle{Key: key}
+		s.throttles[key] = t
+	}
+	t.Failures++
+	t.LastFailureAt = time.Now()
+	return t, nil
+}
+
+func (s *fakeStorage) LockLogin(_ context.Context, key string, until time.Time) error {
+	s.throttles[key].LockedUntil = &until
+	return nil
+}
+
+func (s *fakeStorage) ResetLoginThrottle(_ context.Context, key string) error {
+	delete(s.throttles, key)
+	return nil
+}
+
+func (s *fakeStorage) SaveAuditEvent(_ context.Context, e *models.AuditEvent) error {
+	s.events = append(s.events, e)
+	return nil
+}
+
+func (s *fakeStorage) UserAccess(_ context.Context, _ int64) (*models.UserAccess, error) {
+	return &models.UserAccess{}, nil
+}
+
+func (s *fakeStorage) SaveRefreshToken(_ context.Context, rt *models.RefreshToken) error {
+	s.refresh = append(s.refresh, rt)
+	return nil
+}
+
+// fakeTokenProvider issues opaque token pairs.
+type fakeTokenProvider struct {
+	TokenProvider
+}
+
+func (fakeTokenProvider) NewPair(_ string, _ int64, _ bool, _ models.UserAccess, _ models.Session) (*models.TokenPair, error) {
+	return &models.TokenPair{
+		AccessToken:      "access",
+		RefreshToken:     "refresh",
+		AccessExpiresAt:  time.Now().Add(time.Minute),
+		RefreshExpiresAt: time.Now().Add(time.Hour),
+	}, nil
+}
+
+func (s *fakeStorage) SetEmailVerified(_ context.Context, userId int64, verifiedAt time.Time) error {
+	s.users[userId].EmailVerifiedAt = &verifiedAt
+	return nil
+}
+
+func (s *fakeStorage) ClaimAccount(_ context.Context, userId int64, hPassword []byte, verifiedAt time.Time) error {
+	u := s.users[userId]
+	u.HPassword = string(hPassword)
+	u.EmailVerifiedAt = &verifiedAt
+	delete(s.totp, userId)
+	credentials := s.credentials[:0]
+	for _, c := range s.credentials {
+		if c.UserId != userId {
+			credentials = append(credentials, c)
+		}
+	}
+	s.credentials = credentials
+	return nil
+}
+
+func (s *fakeStorage) SetTokensValidAfter(_ context.Context, userId int64, validAfter time.Time) error {
+	s.users[userId].TokensValidAfter = &validAfter
+	return nil
+}
+
+func (s *fakeStorage) RevokeUserRefreshTokens(_ context.Context, userId int64) error {
+	now := time.Now()
+	for _, rt := range s.refresh {
+		if rt.UserId == userId && rt.RevokedAt == nil {
+			rt.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (s *fakeStorage) UseOneTimeToken(_ context.Context, purpose string, tokenHash string) (*models.OneTimeToken, error) {
+	t, ok := s.oneTime[tokenHash]
+	if !ok || t.Purpose != purpose || t.UsedAt != nil || !t.ExpiresAt.After(time.Now()) {
+		return nil, storage.ErrOneTimeTokenInvalid
+	}
+	now := time.Now()
+	t.UsedAt = &now
+	return t, nil
+}
+
+func (s *fakeStorage) InvalidateOneTimeTokens(_ context.Context, userId int64, purpose string) error {
+	now := time.Now()
+	for _, t := range s.oneTime {
+		if t.UserId == userId && t.Purpose == purpose && t.UsedAt == nil {
+			t.UsedAt = &now
+		}
+	}
+	return nil
+}
+
+func (s *fakeStorage) TOTP(_ context.Context, userId int64) (*models.TOTP, error) {
+	t, ok := s.totp[userId]
+	if !ok {
+		return nil, storage.ErrTOTPNotFound
+	}
+	return t, nil
+}
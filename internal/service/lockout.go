@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/vindosVP/snauth/internal/models"
+	"github.com/vindosVP/snauth/internal/reqctx"
+	"github.com/vindosVP/snauth/internal/storage"
+)
+
+type LoginThrottleStorage interface {
+	LoginThrottle(ctx context.Context, key string) (*models.LoginThrottle, error)
+	RecordLoginFailure(ctx context.Context, key string, resetBefore time.Time) (*models.LoginThrottle, error)
+	LockLogin(ctx context.Context, key string, until time.Time) error
+	ResetLoginThrottle(ctx context.Context, key string) error
+}
+
+// UnlockUser clears the failed logins of the user.
+func (a *Auth) UnlockUser(ctx context.Context, id int64) error {
+	_, err := a.us.UserByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserDoesNotExist) {
+			return ErrUserDoesNotExist
+		}
+		return errors.Wrap(err, "failed to get user by id")
+	}
+	err = a.ls.ResetLoginThrottle(ctx, userThrottleKey(id))
+	if err != nil {
+		return err
+	}
+	return a.audit(ctx, models.AuditUnlockUser, id, "")
+}
+
+// checkLoginLock fails with a *LoginLockedError while the key is locked.
+func (a *Auth) checkLoginLock(ctx context.Context, key string) error {
+	t, err := a.ls.LoginThrottle(ctx, key)
+	if err != nil {
+		return err
+	}
+	if t.LockedUntil != nil && t.LockedUntil.After(time.Now()) {
+		return &LoginLockedError{Until: *t.LockedUntil}
+	}
+	return nil
+}
+
+// recordLoginFailure counts a failed login and locks the key once
+// maxFailures is reached. Every further failure doubles the lockout up
+// to LoginMaxLockout. A non-positive maxFailures disables locking.
+func (a *Auth) recordLoginFailure(ctx context.Context, key string, maxFailures int) error {
+	if maxFailures <= 0 {
+		return nil
+	}
+	now := time.Now()
+	t, err := a.ls.RecordLoginFailure(ctx, key, now.Add(-a.cfg.LoginFailureWindow))
+	if err != nil {
+		return err
+	}
+	if t.Failures < maxFailures {
+		return nil
+	}
+	return a.ls.LockLogin(ctx, key, now.Add(a.lockoutDuration(t.Failures-maxFailures)))
+}
+
+func (a *Auth) lockoutDuration(excess int) time.Duration {
+	d := a.cfg.LoginLockout
+	for i := 0; i < excess && d < a.cfg.LoginMaxLockout; i++ {
+		d *= 2
+	}
+	return min(d, a.cfg.LoginMaxLockout)
+}
+
+// loginFailed records the failure for the account, if it is known, and
+// for the client address.
+func (a *Auth) loginFailed(ctx context.Context, u *models.User) error {
+	if u != nil {
+		if err := a.recordLoginFailure(ctx, userThrottleKey(u.Id), a.cfg.LoginMaxFailures); err != nil {
+			return err
+		}
+	}
+	if ip := reqctx.ClientIP(ctx); ip != "" {
+		if err := a.recordLoginFailure(ctx, ipThrottleKey(ip), a.cfg.LoginMaxIPFailures); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func userThrottleKey(id int64) string {
+	return fmt.Sprintf("user:%d", id)
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
@@ -0,0 +1,257 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/vindosVP/snauth/internal/jwt"
+	"github.com/vindosVP/snauth/internal/models"
+	"github.com/vindosVP/snauth/internal/reqctx"
+	"github.com/vindosVP/snauth/internal/storage"
+	"github.com/vindosVP/snauth/internal/totp"
+)
+
+const (
+	recoveryCodeCount = 10
+	// recoveryCodeLength is in base32 characters, 5 bits each.
+	recoveryCodeLength = 10
+)
+
+type MFAStorage interface {
+	SaveTOTP(ctx context.Context, userId int64, secret []byte) error
+	TOTP(ctx context.Context, userId int64) (*models.TOTP, error)
+	ConfirmTOTP(ctx context.Context, userId int64, counter int64, recoveryCodeHashes []string) error
+	UseTOTPCounter(ctx context.Context, userId int64, counter int64) error
+	UseRecoveryCode(ctx context.Context, userId int64, codeHash string) error
+}
+
+// SecretBox encrypts the TOTP secrets at rest.
+type SecretBox interface {
+	Seal(plaintext []byte) ([]byte, error)
+	Open(sealed []byte) ([]byte, error)
+}
+
+// BeginTOTPEnrollment generates a new TOTP secret for the user. It has to
+// be confirmed with a code before it is required on login.
+func (a *Auth) BeginTOTPEnrollment(ctx context.Context, userId int64) (*models.TOTPEnrollment, error) {
+	if a.box == nil {
+		return nil, ErrMFAUnavailable
+	}
+	u, err := a.us.UserByID(ctx, userId)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserDoesNotExist) {
+			return nil, ErrUserDoesNotExist
+		}
+		return nil, errors.Wrap(err, "failed to get user by id")
+	}
+	enabled, err := a.mfaEnabled(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := a.box.Seal(secret)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encrypt totp secret")
+	}
+	err = a.ms.SaveTOTP(ctx, userId, sealed)
+	if err != nil {
+		return nil, err
+	}
+	return &models.TOTPEnrollment{
+		Secret: totp.EncodeSecret(secret),
+		URI:    totp.URI(a.cfg.MFAIssuer, u.Email, secret),
+	}, nil
+}
+
+// ConfirmTOTPEnrollment enables MFA once the user proves the authenticator
+// works and returns the recovery codes. They are only stored hashed, so
+// this is the only time they can be shown.
+func (a *Auth) ConfirmTOTPEnrollment(ctx context.Context, userId int64, code string) ([]string, error) {
+	if a.box == nil {
+		return nil, ErrMFAUnavailable
+	}
+	t, err := a.ms.TOTP(ctx, userId)
+	if err != nil {
+		if errors.Is(err, storage.ErrTOTPNotFound) {
+			return nil, ErrNoTOTPEnrollment
+		}
+		return nil, err
+	}
+	if t.ConfirmedAt != nil {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	secret, err := a.box.Open(t.Secret)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decrypt totp secret")
+	}
+	counter, ok := totp.Validate(secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		c, err := recoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, c)
+		hashes = append(hashes, hashToken(normalizeRecoveryCode(c)))
+	}
+	err = a.ms.ConfirmTOTP(ctx, userId, counter, hashes)
+	if err != nil {
+		if errors.Is(err, storage.ErrTOTPNotFound) {
+			return nil, ErrNoTOTPEnrollment
+		}
+		return nil, err
+	}
+	err = a.audit(ctx, models.AuditMFAEnabled, userId, "totp")
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// VerifyMFA completes a login with a TOTP or a recovery code. Failed codes
+// count towards the login lockout like wrong passwords.
+func (a *Auth) VerifyMFA(ctx context.Context, mfaToken string, code string) (*models.TokenPair, error) {
+	claims, err := a.t.ParseMFA(mfaToken)
+	if err != nil {
+		if errors.Is(err, jwt.ErrInvalidToken) {
+			return nil, ErrInvalidMFAToken
+		}
+		return nil, errors.Wrap(err, "failed to parse mfa token")
+	}
+	if ip := reqctx.ClientIP(ctx); ip != "" {
+		if err := a.checkLoginLock(ctx, ipThrottleKey(ip)); err != nil {
+			return nil, a.loginRejected(ctx, claims.Id, "client address is locked", err)
+		}
+	}
+	u, err := a.us.UserByID(ctx, claims.Id)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserDoesNotExist) {
+			return nil, ErrInvalidMFAToken
+		}
+		return nil, errors.Wrap(err, "failed to get user by id")
+	}
+	revoked, err := a.tokenRevoked(ctx, u, claims)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrInvalidMFAToken
+	}
+	if err := a.checkLoginLock(ctx, userThrottleKey(u.Id)); err != nil {
+		return nil, a.loginRejected(ctx, u.Id, "account is locked", err)
+	}
+	if u.IsBanned || u.IsDeleted {
+		return nil, a.loginRejected(ctx, u.Id, "user is deleted or banned", ErrUserUnableToLogIn)
+	}
+	err = a.checkSecondFactor(ctx, u.Id, code)
+	if err != nil {
+		if !errors.Is(err, ErrInvalidMFACode) {
+			return nil, err
+		}
+		if err := a.loginFailed(ctx, u); err != nil {
+			return nil, err
+		}
+		return nil, a.loginRejected(ctx, u.Id, "invalid mfa code", ErrInvalidMFACode)
+	}
+	err = a.ls.ResetLoginThrottle(ctx, userThrottleKey(u.Id))
+	if err != nil {
+		return nil, err
+	}
+	err = a.audit(ctx, models.AuditLoginSucceeded, u.Id, "mfa")
+	if err != nil {
+		return nil, err
+	}
+	return a.newSession(ctx, u)
+}
+
+// checkSecondFactor accepts six digit TOTP codes and recovery codes.
+func (a *Auth) checkSecondFactor(ctx context.Context, userId int64, code string) error {
+	t, err := a.ms.TOTP(ctx, userId)
+	if err != nil {
+		if errors.Is(err, storage.ErrTOTPNotFound) {
+			return ErrInvalidMFAToken
+		}
+		return err
+	}
+	if t.ConfirmedAt == nil {
+		return ErrInvalidMFAToken
+	}
+	code = strings.TrimSpace(code)
+	if !isTOTPCode(code) {
+		err := a.ms.UseRecoveryCode(ctx, userId, hashToken(normalizeRecoveryCode(code)))
+		if errors.Is(err, storage.ErrRecoveryCodeInvalid) {
+			return ErrInvalidMFACode
+		}
+		return err
+	}
+	if a.box == nil {
+		return ErrMFAUnavailable
+	}
+	secret, err := a.box.Open(t.Secret)
+	if err != nil {
+		return errors.Wrap(err, "failed to decrypt totp secret")
+	}
+	counter, ok := totp.Validate(secret, code, time.Now())
+	if !ok {
+		return ErrInvalidMFACode
+	}
+	err = a.ms.UseTOTPCounter(ctx, userId, counter)
+	if errors.Is(err, storage.ErrTOTPCodeUsed) {
+		return ErrInvalidMFACode
+	}
+	return err
+}
+
+func (a *Auth) mfaEnabled(ctx context.Context, userId int64) (bool, error) {
+	t, err := a.ms.TOTP(ctx, userId)
+	if err != nil {
+		if errors.Is(err, storage.ErrTOTPNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return t.ConfirmedAt != nil, nil
+}
+
+func isTOTPCode(code string) bool {
+	if len(code) != 6 {
+		return false
+	}
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// recoveryCode returns a random code formatted like abcde-fghij.
+func recoveryCode() (string, error) {
+	b := make([]byte, recoveryCodeLength*5/8)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "failed to generate recovery code")
+	}
+	c := strings.ToLower(recoveryCodeEncoding.EncodeToString(b))
+	return c[:recoveryCodeLength/2] + "-" + c[recoveryCodeLength/2:], nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
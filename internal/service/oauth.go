@@ -0,0 +1,355 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/vindosVP/snauth/internal/jwt"
+	"github.com/vindosVP/snauth/internal/models"
+	"github.com/vindosVP/snauth/internal/storage"
+)
+
+const (
+	ScopeOpenID = "openid"
+	ScopeEmail  = "email"
+)
+
+// SupportedScopes lists the scopes clients can be granted, others are
+// ignored.
+var SupportedScopes = []string{ScopeOpenID, ScopeEmail}
+
+type OAuthStorage interface {
+	CreateOAuthClient(ctx context.Context, c *models.OAuthClient) error
+	OAuthClient(ctx context.Context, clientId string) (*models.OAuthClient, error)
+	OAuthClients(ctx context.Context) ([]*models.OAuthClient, error)
+	DeleteOAuthClient(ctx context.Context, clientId string) error
+	SaveAuthorizationCode(ctx context.Context, c *models.AuthorizationCode) error
+	UseAuthorizationCode(ctx context.Context, codeHash string) (*models.AuthorizationCode, error)
+}
+
+// CreateOAuthClient registers a client and returns its secret, which is
+// only stored hashed. Public clients get no secret.
+func (a *Auth) CreateOAuthClient(ctx context.Context, name string, redirectURIs []string, public bool) (*models.OAuthClient, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", ErrInvalidClientName
+	}
+	if len(redirectURIs) == 0 {
+		return nil, "", ErrInvalidRedirectURI
+	}
+	for _, uri := range redirectURIs {
+		if !validRedirectURI(uri) {
+			return nil, "", ErrInvalidRedirectURI
+		}
+	}
+	clientId, err := randomToken()
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to generate client id")
+	}
+	c := &models.OAuthClient{
+		ClientId:     clientId,
+		Name:         name,
+		RedirectURIs: redirectURIs,
+	}
+	var secret string
+	if !public {
+		secret, err = newClientSecret()
+		if err != nil {
+			return nil, "", err
+		}
+		c.SecretHash = hashToken(secret)
+	}
+	err = a.oa.CreateOAuthClient(ctx, c)
+	if err != nil {
+		return nil, "", err
+	}
+	err = a.audit(ctx, models.AuditOAuthClientCreated, 0, "client "+c.ClientId)
+	if err != nil {
+		return nil, "", err
+	}
+	return c, secret, nil
+}
+
+func (a *Auth) ListOAuthClients(ctx context.Context) ([]*models.OAuthClient, error) {
+	return a.oa.OAuthClients(ctx)
+}
+
+// DeleteOAuthClient removes the client, its pending authorization codes
+// and its refresh tokens. Access tokens already issued to it stay valid
+// until they expire.
+func (a *Auth) DeleteOAuthClient(ctx context.Context, clientId string) error {
+	err := a.oa.DeleteOAuthClient(ctx, clientId)
+	if err != nil {
+		if errors.Is(err, storage.ErrOAuthClientDoesNotExist) {
+			return ErrOAuthClientDoesNotExist
+		}
+		return err
+	}
+	return a.audit(ctx, models.AuditOAuthClientDeleted, 0, "client "+clientId)
+}
+
+// CheckAuthorizationRequest verifies the client and that the redirect URI
+// is registered for it. Errors of requests failing it must not be
+// redirected.
+func (a *Auth) CheckAuthorizationRequest(ctx context.Context, clientId string, redirectURI string) error {
+	c, err := a.oa.OAuthClient(ctx, clientId)
+	if err != nil {
+		if errors.Is(err, storage.ErrOAuthClientDoesNotExist) {
+			return ErrInvalidOAuthClient
+		}
+		return err
+	}
+	if !slices.Contains(c.RedirectURIs, redirectURI) {
+		return ErrInvalidRedirectURI
+	}
+	return nil
+}
+
+// Authorize issues an authorization code to the user the access token
+// belongs to. The request has to pass CheckAuthorizationRequest first.
+// PKCE with S256 is required for every client.
+func (a *Auth) Authorize(ctx context.Context, accessToken string, req models.AuthorizationRequest) (string, error) {
+	scope, err := grantedScope(req.Scope)
+	if err != nil {
+		return "", err
+	}
+	if !validCodeChallenge(req.CodeChallenge) {
+		return "", ErrInvalidCodeChallenge
+	}
+	claims, err := a.t.ParseAccess(accessToken)
+	if err != nil {
+		if errors.Is(err, jwt.ErrInvalidToken) {
+			return "", ErrLoginRequired
+		}
+		return "", errors.Wrap(err, "failed to parse access token")
+	}
+	if _, ok := claims.ServiceAccount(); ok {
+		return "", ErrLoginRequired
+	}
+	u, err := a.us.UserByID(ctx, claims.Id)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserDoesNotExist) {
+			return "", ErrLoginRequired
+		}
+		return "", errors.Wrap(err, "failed to get user by id")
+	}
+	revoked, err := a.tokenRevoked(ctx, u, claims)
+	if err != nil {
+		return "", err
+	}
+	if revoked {
+		return "", ErrLoginRequired
+	}
+	if u.IsBanned || u.IsDeleted {
+		return "", ErrUserUnableToLogIn
+	}
+	code, err := randomToken()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to generate authorization code")
+	}
+	// Tokens issued before sessions carried auth_time fall back to iat.
+	authTime := time.Now()
+	if claims.AuthTime != nil {
+		authTime = claims.AuthTime.Time
+	} else if claims.IssuedAt != nil {
+		authTime = claims.IssuedAt.Time
+	}
+	err = a.oa.SaveAuthorizationCode(ctx, &models.AuthorizationCode{
+		CodeHash:      hashToken(code),
+		ClientId:      req.ClientId,
+		UserId:        u.Id,
+		RedirectURI:   req.RedirectURI,
+		Scope:         scope,
+		Nonce:         req.Nonce,
+		CodeChallenge: req.CodeChallenge,
+		AuthTime:      authTime,
+		ExpiresAt:     time.Now().Add(a.cfg.AuthorizationCodeTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	err = a.audit(ctx, models.AuditOAuthAuthorized, u.Id, "client "+req.ClientId)
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// ExchangeAuthorizationCode redeems the code for an ID token and a token
+// pair of a new session bound to the client and limited to the granted
+// scope.
+func (a *Auth) ExchangeAuthorizationCode(ctx context.Context, clientId string, clientSecret string, code string, redirectURI string, codeVerifier string) (*models.OIDCTokens, error) {
+	_, err := a.authenticateClient(ctx, clientId, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+	c, err := a.oa.UseAuthorizationCode(ctx, hashToken(code))
+	if err != nil {
+		if errors.Is(err, storage.ErrAuthorizationCodeInvalid) {
+			return nil, ErrInvalidGrant
+		}
+		return nil, err
+	}
+	if c.ClientId != clientId || c.RedirectURI != redirectURI || !verifyCodeChallenge(c.CodeChallenge, codeVerifier) {
+		return nil, ErrInvalidGrant
+	}
+	u, err := a.us.UserByID(ctx, c.UserId)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserDoesNotExist) {
+			return nil, ErrInvalidGrant
+		}
+		return nil, errors.Wrap(err, "failed to get user by id")
+	}
+	if u.IsBanned || u.IsDeleted {
+		return nil, ErrInvalidGrant
+	}
+	tokens, err := a.startSession(ctx, u, models.Session{
+		ClientId: clientId,
+		Scope:    c.Scope,
+		AuthTime: c.AuthTime,
+	})
+	if err != nil {
+		return nil, err
+	}
+	idToken := models.IDToken{
+		UserId:   u.Id,
+		ClientId: clientId,
+		Nonce:    c.Nonce,
+		AuthTime: c.AuthTime,
+	}
+	if slices.Contains(strings.Fields(c.Scope), ScopeEmail) {
+		idToken.Email = u.Email
+		idToken.EmailVerified = u.EmailVerifiedAt != nil
+	}
+	idTokenString, err := a.t.NewIDToken(idToken)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create id token")
+	}
+	return &models.OIDCTokens{TokenPair: tokens, IDToken: idTokenString, Scope: c.Scope}, nil
+}
+
+// RefreshOAuthTokens is Refresh for authenticated OAuth clients. Only
+// sessions issued to the client are accepted.
+func (a *Auth) RefreshOAuthTokens(ctx context.Context, clientId string, clientSecret string, refreshToken string) (*models.TokenPair, error) {
+	_, err := a.authenticateClient(ctx, clientId, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+	return a.refresh(ctx, refreshToken, clientId)
+}
+
+// UserInfo returns the claims about the user of an active access token
+// issued to an OAuth client, limited to the granted scope.
+func (a *Auth) UserInfo(ctx context.Context, accessToken string) (*models.UserInfo, error) {
+	claims, err := a.t.ParseOAuthAccess(accessToken)
+	if err != nil {
+		if errors.Is(err, jwt.ErrInvalidToken) {
+			return nil, ErrInvalidAccessToken
+		}
+		return nil, errors.Wrap(err, "failed to parse access token")
+	}
+	u, err := a.tokenUser(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return nil, ErrInvalidAccessToken
+	}
+	ui := &models.UserInfo{UserId: u.Id}
+	if slices.Contains(strings.Fields(claims.Scope), ScopeEmail) {
+		ui.Email = u.Email
+		ui.EmailVerified = u.EmailVerifiedAt != nil
+	}
+	return ui, nil
+}
+
+// authenticateClient checks the secret of confidential clients. Public
+// clients must not send one.
+func (a *Auth) authenticateClient(ctx context.Context, clientId string, clientSecret string) (*models.OAuthClient, error) {
+	c, err := a.oa.OAuthClient(ctx, clientId)
+	if err != nil {
+		if errors.Is(err, storage.ErrOAuthClientDoesNotExist) {
+			return nil, ErrInvalidOAuthClient
+		}
+		return nil, err
+	}
+	if c.Public() {
+		if clientSecret != "" {
+			return nil, ErrInvalidOAuthClient
+		}
+		return c, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(hashToken(clientSecret)), []byte(c.SecretHash)) != 1 {
+		return nil, ErrInvalidOAuthClient
+	}
+	return c, nil
+}
+
+func newClientSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "failed to generate client secret")
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// grantedScope keeps the supported scopes of the request, openid is
+// required.
+func grantedScope(requested string) (string, error) {
+	granted := make([]string, 0, len(SupportedScopes))
+	for _, s := range strings.Fields(requested) {
+		if slices.Contains(SupportedScopes, s) && !slices.Contains(granted, s) {
+			granted = append(granted, s)
+		}
+	}
+	if !slices.Contains(granted, ScopeOpenID) {
+		return "", ErrInvalidScope
+	}
+	return strings.Join(granted, " "), nil
+}
+
+// validCodeChallenge accepts S256 challenges, the base64url encoded
+// SHA-256 of the verifier.
+func validCodeChallenge(challenge string) bool {
+	b, err := base64.RawURLEncoding.DecodeString(challenge)
+	return err == nil && len(b) == sha256.Size
+}
+
+func verifyCodeChallenge(challenge string, verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// validRedirectURI requires absolute URIs without fragments. Plain http
+// is only allowed for loopback addresses.
+func validRedirectURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || !u.IsAbs() || u.Fragment != "" || u.Host == "" {
+		return false
+	}
+	switch u.Scheme {
+	case "https":
+		return true
+	case "http":
+		if u.Hostname() == "localhost" {
+			return true
+		}
+		ip := net.ParseIP(u.Hostname())
+		return ip != nil && ip.IsLoopback()
+	}
+	return false
+}
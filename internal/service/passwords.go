@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vindosVP/snauth/internal/models"
+	"github.com/vindosVP/snauth/internal/storage"
+)
+
+// RequestPasswordReset sends a single-use reset token to the user.
+// Unknown, banned and deleted accounts are silently skipped, so the
+// response does not reveal which emails are registered. At most
+// PasswordResetLimit requests are accepted per email and
+// PasswordResetWindow, whether an account exists or not.
+func (a *Auth) RequestPasswordReset(ctx context.Context, email string) error {
+	limited, err := a.requestLimited(ctx, "password_reset:"+strings.ToLower(strings.TrimSpace(email)), a.cfg.PasswordResetLimit, a.cfg.PasswordResetWindow)
+	if err != nil {
+		return err
+	}
+	if limited {
+		return ErrTooManyPasswordResetRequests
+	}
+	u, err := a.us.UserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserDoesNotExist) {
+			return nil
+		}
+		return errors.Wrap(err, "failed to get user by email")
+	}
+	if u.IsBanned || u.IsDeleted {
+		return nil
+	}
+	token, err := a.issueOneTimeToken(ctx, u.Id, models.TokenPurposePasswordReset, a.cfg.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+	err = a.n.Notify(ctx, models.Message{
+		To:      u.Email,
+		Subject: "Password reset",
+		Body:    tokenBody("password reset", a.cfg.PasswordResetURL, token),
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to send password reset token")
+	}
+	return nil
+}
+
+// ConfirmPasswordReset consumes the reset token, sets the new password
+// and ends every session of the user. The token is only consumed once
+// the new password passes the policy, so the user can retry with another.
+func (a *Auth) ConfirmPasswordReset(ctx context.Context, token string, newPassword string) error {
+	t, err := a.ts.OneTimeToken(ctx, models.TokenPurposePasswordReset, hashToken(token))
+	if err != nil {
+		if errors.Is(err, storage.ErrOneTimeTokenInvalid) {
+			return ErrInvalidResetToken
+		}
+		return errors.Wrap(err, "failed to get password reset token")
+	}
+	u, err := a.us.UserByID(ctx, t.UserId)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserDoesNotExist) {
+			return ErrInvalidResetToken
+		}
+		return errors.Wrap(err, "failed to get user by id")
+	}
+	if u.IsBanned || u.IsDeleted {
+		return ErrUserUnableToLogIn
+	}
+	if err := a.checkPassword(u.Email, newPassword); err != nil {
+		return err
+	}
+	_, err = a.ts.UseOneTimeToken(ctx, models.TokenPurposePasswordReset, t.TokenHash)
+	if err != nil {
+		if errors.Is(err, storage.ErrOneTimeTokenInvalid) {
+			return ErrInvalidResetToken
+		}
+		return errors.Wrap(err, "failed to use password reset token")
+	}
+	hPassword, err := a.ph.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+	err = a.us.UpdatePassword(ctx, t.UserId, hPassword)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserDoesNotExist) {
+			return ErrInvalidResetToken
+		}
+		return errors.Wrap(err, "failed to update password")
+	}
+	err = a.ts.InvalidateOneTimeTokens(ctx, t.UserId, models.TokenPurposePasswordReset)
+	if err != nil {
+		return errors.Wrap(err, "failed to invalidate password reset tokens")
+	}
+	return a.revokeSessions(ctx, t.UserId, models.RevocationReasonPassword)
+}
+
+// ChangePassword sets a new password after checking the current one.
+// If revokeOthers is set every session of the user is ended and a new
+// token pair is returned for the caller to continue with. Wrong current
+// passwords count towards the same lockout as Login, so a stolen access
+// token cannot be used to guess the password.
+func (a *Auth) ChangePassword(ctx context.Context, userId int64, oldPassword string, newPassword string, revokeOthers bool) (*models.TokenPair, error) {
+	u, err := a.us.UserByID(ctx, userId)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserDoesNotExist) {
+			return nil, ErrUserDoesNotExist
+		}
+		return nil, errors.Wrap(err, "failed to get user by id")
+	}
+	if err := a.checkLoginLock(ctx, userThrottleKey(u.Id)); err != nil {
+		return nil, err
+	}
+	err = a.ph.Compare([]byte(u.HPassword), oldPassword)
+	if err != nil {
+		if err := a.loginFailed(ctx, u); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidPassword
+	}
+	if u.IsBanned || u.IsDeleted {
+		return nil, ErrUserUnableToLogIn
+	}
+	if err := a.checkPassword(u.Email, newPassword); err != nil {
+		return nil, err
+	}
+	hPassword, err := a.ph.Hash(newPassword)
+	if err != nil {
+		return nil, err
+	}
+	err = a.us.UpdatePassword(ctx, u.Id, hPassword)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to update password")
+	}
+	err = a.ts.InvalidateOneTimeTokens(ctx, u.Id, models.TokenPurposePasswordReset)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to invalidate password reset tokens")
+	}
+	if !revokeOthers {
+		return nil, nil
+	}
+	err = a.revokeSessions(ctx, u.Id, models.RevocationReasonPassword)
+	if err != nil {
+		return nil, err
+	}
+	return a.newSession(ctx, u)
+}
+
+// issueOneTimeToken stores the hash of a new random token and returns the
+// token itself.
+func (a *Auth) issueOneTimeToken(ctx context.Context, userId int64, purpose string, ttl time.Duration) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "failed to generate token")
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	err := a.ts.SaveOneTimeToken(ctx, &models.OneTimeToken{
+		UserId:    userId,
+		Purpose:   purpose,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to save token")
+	}
+	return token, nil
+}
+
+// tokenBody hands out the token itself, or a link carrying it if the
+// page to complete the action on is configured.
+func tokenBody(action string, link string, token string) string {
+	if link == "" {
+		return fmt.Sprintf("Your %s token is %s", action, token)
+	}
+	return fmt.Sprintf("Complete your %s by following this link: %s", action, withToken(link, token))
+}
+
+// withToken appends the token to the link as a query parameter.
+func withToken(link string, token string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return token
+	}
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/vindosVP/snauth/internal/models"
+	"github.com/vindosVP/snauth/internal/storage"
+)
+
+type RoleStorage interface {
+	CreateRole(ctx context.Context, name string, permissions []string) (*models.Role, error)
+	RoleByName(ctx context.Context, name string) (*models.Role, error)
+	Roles(ctx context.Context) ([]*models.Role, error)
+	GrantPermission(ctx context.Context, roleId int64, permission string) error
+	RevokePermission(ctx context.Context, roleId int64, permission string) error
+	AssignRole(ctx context.Context, userId int64, roleId int64) error
+	UnassignRole(ctx context.Context, userId int64, roleId int64) error
+	UserAccess(ctx context.Context, userId int64) (*models.UserAccess, error)
+}
+
+// CreateRole creates a role granted the permissions. Callers can only
+// grant permissions they hold themselves.
+func (a *Auth) CreateRole(ctx context.Context, name string, permissions []string) (*models.Role, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, ErrInvalidRoleName
+	}
+	for _, p := range permissions {
+		if !slices.Contains(models.Permissions, p) {
+			return nil, ErrUnknownPermission
+		}
+		if !callerCan(ctx, p) {
+			return nil, ErrPermissionNotHeld
+		}
+	}
+	_, err := a.rs.CreateRole(ctx, name, permissions)
+	if err != nil {
+		if errors.Is(err, storage.ErrRoleAlreadyExists) {
+			return nil, ErrRoleAlreadyExists
+		}
+		return nil, errors.Wrap(err, "failed to create role")
+	}
+	err = a.audit(ctx, models.AuditCreateRole, 0, name)
+	if err != nil {
+		return nil, err
+	}
+	return a.role(ctx, name)
+}
+
+func (a *Auth) ListRoles(ctx context.Context) ([]*models.Role, error) {
+	return a.rs.Roles(ctx)
+}
+
+// GrantPermission grants the permission to the role. Users holding the
+// role get it with their next request. Callers can only grant
+// permissions they hold themselves.
+func (a *Auth) GrantPermission(ctx context.Context, roleName string, permission string) (*models.Role, error) {
+	return a.changePermission(ctx, roleName, permission, true)
+}
+
+// RevokePermission takes the permission from the role.
+func (a *Auth) RevokePermission(ctx context.Context, roleName string, permission string) (*models.Role, error) {
+	return a.changePermission(ctx, roleName, permission, false)
+}
+
+func (a *Auth) changePermission(ctx context.Context, roleName string, permission string, grant bool) (*models.Role, error) {
+	if !slices.Contains(models.Permissions, permission) {
+		return nil, ErrUnknownPermission
+	}
+	if grant && !callerCan(ctx, permission) {
+		return nil, ErrPermissionNotHeld
+	}
+	r, err := a.role(ctx, roleName)
+	if err != nil {
+		return nil, err
+	}
+	event := models.AuditGrantPermission
+	if grant {
+		err = a.rs.GrantPermission(ctx, r.Id, permission)
+	} else {
+		event = models.AuditRevokePermission
+		err = a.rs.RevokePermission(ctx, r.Id, permission)
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = a.audit(ctx, event, 0, roleName+" "+permission)
+	if err != nil {
+		return nil, err
+	}
+	return a.role(ctx, roleName)
+}
+
+// AssignRole gives the user the role. Callers can only assign roles whose
+// permissions they hold themselves.
+func (a *Auth) AssignRole(ctx context.Context, userId int64, roleName string) error {
+	return a.changeRole(ctx, userId, roleName, true)
+}
+
+func (a *Auth) UnassignRole(ctx context.Context, userId int64, roleName string) error {
+	return a.changeRole(ctx, userId, roleName, false)
+}
+
+func (a *Auth) changeRole(ctx context.Context, userId int64, roleName string, assign bool) error {
+	_, err := a.us.UserByID(ctx, userId)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserDoesNotExist) {
+			return ErrUserDoesNotExist
+		}
+		return errors.Wrap(err, "failed to get user by id")
+	}
+	r, err := a.role(ctx, roleName)
+	if err != nil {
+		return err
+	}
+	if assign {
+		for _, p := range r.Permissions {
+			if !callerCan(ctx, p) {
+				return ErrPermissionNotHeld
+			}
+		}
+	}
+	event := models.AuditAssignRole
+	if assign {
+		err = a.rs.AssignRole(ctx, userId, r.Id)
+	} else {
+		event = models.AuditUnassignRole
+		err = a.rs.UnassignRole(ctx, userId, r.Id)
+	}
+	if err != nil {
+		return err
+	}
+	return a.audit(ctx, event, userId, roleName)
+}
+
+func (a *Auth) role(ctx context.Context, name string) (*models.Role, error) {
+	r, err := a.rs.RoleByName(ctx, name)
+	if err != nil {
+		if errors.Is(err, storage.ErrRoleDoesNotExist) {
+			return nil, ErrRoleDoesNotExist
+		}
+		return nil, errors.Wrap(err, "failed to get role by name")
+	}
+	return r, nil
+}
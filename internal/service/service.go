@@ -2,13 +2,15 @@ package auth
 
 import (
 	"context"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 
-	"golang.org/x/crypto/bcrypt"
-
 	"github.com/vindosVP/snauth/internal/jwt"
 	"github.com/vindosVP/snauth/internal/models"
+	"github.com/vindosVP/snauth/internal/reqctx"
 	"github.com/vindosVP/snauth/internal/storage"
 )
 
@@ -19,26 +21,185 @@ type UserStorage interface {
 	SetDeletedToUser(ctx context.Context, userId int64, isDeleted bool) (bool, error)
 	SetBannedToUser(ctx context.Context, userId int64, isBanned bool) (bool, error)
 	SetAdminToUser(ctx context.Context, userId int64, isAdmin bool) (bool, error)
+	SetTokensValidAfter(ctx context.Context, userId int64, validAfter time.Time) error
+	UpdatePassword(ctx context.Context, userId int64, hPassword []byte) error
+	SetEmailVerified(ctx context.Context, userId int64, verifiedAt time.Time) error
+	ClaimAccount(ctx context.Context, userId int64, hPassword []byte, verifiedAt time.Time) error
+	ListUsers(ctx context.Context, filter models.UserFilter, page models.UserPage) ([]*models.User, error)
+	CountUsers(ctx context.Context, filter models.UserFilter) (int64, error)
 }
 
 type TokenProvider interface {
-	NewPair(email string, id int64, isAdmin bool) (*models.TokenPair, error)
-	ParseRefresh(refreshToken string) (int64, error)
+	NewPair(email string, id int64, isAdmin bool, access models.UserAccess, s models.Session) (*models.TokenPair, error)
+	NewOAuthPair(id int64, s models.Session) (*models.TokenPair, error)
+	ParseRefresh(refreshToken string) (*jwt.Claims, error)
+	ParseAccess(accessToken string) (*jwt.Claims, error)
+	ParseOAuthAccess(accessToken string) (*jwt.Claims, error)
+	NewMFAToken(id int64) (string, error)
+	ParseMFA(mfaToken string) (*jwt.Claims, error)
+	NewIDToken(t models.IDToken) (string, error)
+	NewServiceToken(clientId string, scope string) (*models.ServiceToken, error)
+	JWKS() []models.JWK
+}
+
+type KeyRotator interface {
+	Rotate(ctx context.Context) (string, error)
+}
+
+type RevocationBroker interface {
+	Publish(e models.RevocationEvent)
+	Subscribe() (<-chan models.RevocationEvent, func())
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, m models.Message) error
+}
+
+type PasswordHasher interface {
+	Hash(password string) ([]byte, error)
+	Compare(hash []byte, password string) error
+	NeedsRehash(hash []byte) bool
+}
+
+type PasswordPolicy interface {
+	Validate(email string, password string) []models.PasswordViolation
+}
+
+// Config holds the tunables of the service. The URLs point to the pages
+// users complete an emailed action on, the token is appended to them as
+// a query parameter. Without them the bare token is sent.
+type Config struct {
+	PasswordResetTTL         time.Duration
+	PasswordResetURL         string
+	PasswordResetLimit       int
+	PasswordResetWindow      time.Duration
+	VerificationTTL          time.Duration
+	VerificationURL          string
+	VerificationResendLimit  int
+	VerificationResendWindow time.Duration
+	RequireVerifiedEmail     bool
+	LoginMaxFailures         int
+	LoginMaxIPFailures       int
+	LoginFailureWindow       time.Duration
+	LoginLockout             time.Duration
+	LoginMaxLockout          time.Duration
+	MFAIssuer                string
+	WebAuthnSessionTTL       time.Duration
+	WebAuthnDecoyKey         []byte
+	EmailLoginTTL            time.Duration
+	EmailLoginURL            string
+	EmailLoginLimit          int
+	EmailLoginWindow         time.Duration
+	EmailLoginClaimsAccount  bool
+	AuthorizationCodeTTL     time.Duration
 }
 
 type Auth struct {
-	us UserStorage
-	t  TokenProvider
+	us  UserStorage
+	ts  TokenStorage
+	ls  LoginThrottleStorage
+	as  AuditStorage
+	rs  RoleStorage
+	ms  MFAStorage
+	ws  WebAuthnStorage
+	oa  OAuthStorage
+	sa  ServiceAccountStorage
+	t   TokenProvider
+	rb  RevocationBroker
+	n   Notifier
+	pp  PasswordPolicy
+	ph  PasswordHasher
+	box SecretBox
+	rp  RelyingParty
+	kr  KeyRotator
+	cfg Config
 }
 
-func New(us UserStorage, tp TokenProvider) *Auth {
+// Deps holds the collaborators of the service. Optional features are
+// disabled by leaving their dependency nil.
+type Deps struct {
+	Users           UserStorage
+	Tokens          TokenStorage
+	LoginThrottle   LoginThrottleStorage
+	Audit           AuditStorage
+	Roles           RoleStorage
+	MFA             MFAStorage
+	WebAuthn        WebAuthnStorage
+	OAuth           OAuthStorage
+	ServiceAccounts ServiceAccountStorage
+	TokenProvider   TokenProvider
+	Revocations     RevocationBroker
+	Notifier        Notifier
+	PasswordPolicy  PasswordPolicy
+	PasswordHasher  PasswordHasher
+	SecretBox       SecretBox
+	RelyingParty    RelyingParty
+	KeyRotator      KeyRotator
+}
+
+func New(d Deps, cfg Config) *Auth {
 	return &Auth{
-		us: us,
-		t:  tp,
+		us:  d.Users,
+		ts:  d.Tokens,
+		ls:  d.LoginThrottle,
+		as:  d.Audit,
+		rs:  d.Roles,
+		ms:  d.MFA,
+		ws:  d.WebAuthn,
+		oa:  d.OAuth,
+		sa:  d.ServiceAccounts,
+		t:   d.TokenProvider,
+		rb:  d.Revocations,
+		n:   d.Notifier,
+		pp:  d.PasswordPolicy,
+		ph:  d.PasswordHasher,
+		box: d.SecretBox,
+		rp:  d.RelyingParty,
+		kr:  d.KeyRotator,
+		cfg: cfg,
+	}
+}
+
+func (a *Auth) GetUser(ctx context.Context, id int64) (*models.User, error) {
+	u, err := a.us.UserByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserDoesNotExist) {
+			return nil, ErrUserDoesNotExist
+		}
+		return nil, errors.Wrap(err, "failed to get user by id")
+	}
+	return u, nil
+}
+
+func (a *Auth) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	u, err := a.us.UserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserDoesNotExist) {
+			return nil, ErrUserDoesNotExist
+		}
+		return nil, errors.Wrap(err, "failed to get user by email")
 	}
+	return u, nil
 }
 
-func (a *Auth) SetDeleted(ctx context.Context, id int64, deleted bool) (bool, error) {
+// checkSelfChange refuses to let callers lock themselves out unless they
+// confirm it.
+func checkSelfChange(ctx context.Context, id int64, locksOut bool, confirmed bool) error {
+	if !locksOut || confirmed {
+		return nil
+	}
+	if c, ok := reqctx.CallerFromContext(ctx); ok && c.Id == id {
+		return ErrSelfChangeNotConfirmed
+	}
+	return nil
+}
+
+// SetDeleted, SetBanned and SetAdmin fail with ErrLastAdmin instead of
+// leaving no active admin.
+func (a *Auth) SetDeleted(ctx context.Context, id int64, deleted bool, confirmSelf bool) (bool, error) {
+	if err := checkSelfChange(ctx, id, deleted, confirmSelf); err != nil {
+		return false, err
+	}
 	_, err := a.us.UserByID(ctx, id)
 	if err != nil {
 		if errors.Is(err, storage.ErrUserDoesNotExist) {
@@ -48,12 +209,27 @@ func (a *Auth) SetDeleted(ctx context.Context, id int64, deleted bool) (bool, er
 	}
 	isDeleted, err := a.us.SetDeletedToUser(ctx, id, deleted)
 	if err != nil {
+		if errors.Is(err, storage.ErrLastAdmin) {
+			return false, ErrLastAdmin
+		}
 		return false, errors.Wrap(err, "failed to set deleted to user")
 	}
+	if isDeleted {
+		if err := a.revokeSessions(ctx, id, models.RevocationReasonDeleted); err != nil {
+			return false, err
+		}
+	}
+	err = a.audit(ctx, models.AuditSetDeleted, id, strconv.FormatBool(isDeleted))
+	if err != nil {
+		return false, err
+	}
 	return isDeleted, nil
 }
 
-func (a *Auth) SetBanned(ctx context.Context, id int64, banned bool) (bool, error) {
+func (a *Auth) SetBanned(ctx context.Context, id int64, banned bool, confirmSelf bool) (bool, error) {
+	if err := checkSelfChange(ctx, id, banned, confirmSelf); err != nil {
+		return false, err
+	}
 	_, err := a.us.UserByID(ctx, id)
 	if err != nil {
 		if errors.Is(err, storage.ErrUserDoesNotExist) {
@@ -63,12 +239,27 @@ func (a *Auth) SetBanned(ctx context.Context, id int64, banned bool) (bool, erro
 	}
 	isBanned, err := a.us.SetBannedToUser(ctx, id, banned)
 	if err != nil {
+		if errors.Is(err, storage.ErrLastAdmin) {
+			return false, ErrLastAdmin
+		}
 		return false, errors.Wrap(err, "failed to set banned to user")
 	}
+	if isBanned {
+		if err := a.revokeSessions(ctx, id, models.RevocationReasonBanned); err != nil {
+			return false, err
+		}
+	}
+	err = a.audit(ctx, models.AuditSetBanned, id, strconv.FormatBool(isBanned))
+	if err != nil {
+		return false, err
+	}
 	return isBanned, nil
 }
 
-func (a *Auth) SetAdmin(ctx context.Context, id int64, admin bool) (bool, error) {
+func (a *Auth) SetAdmin(ctx context.Context, id int64, admin bool, confirmSelf bool) (bool, error) {
+	if err := checkSelfChange(ctx, id, !admin, confirmSelf); err != nil {
+		return false, err
+	}
 	_, err := a.us.UserByID(ctx, id)
 	if err != nil {
 		if errors.Is(err, storage.ErrUserDoesNotExist) {
@@ -78,15 +269,28 @@ func (a *Auth) SetAdmin(ctx context.Context, id int64, admin bool) (bool, error)
 	}
 	isAdmin, err := a.us.SetAdminToUser(ctx, id, admin)
 	if err != nil {
+		if errors.Is(err, storage.ErrLastAdmin) {
+			return false, ErrLastAdmin
+		}
 		return false, errors.Wrap(err, "failed to set admin to user")
 	}
+	err = a.audit(ctx, models.AuditSetAdmin, id, strconv.FormatBool(isAdmin))
+	if err != nil {
+		return false, err
+	}
 	return isAdmin, nil
 }
 
+// Register creates the user and sends a verification token. The user is
+// created even if the token cannot be sent, the error is then a
+// *VerificationNotSentError and the user can ask for a new token.
 func (a *Auth) Register(ctx context.Context, email string, password string) (int64, error) {
-	hPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err := a.checkPassword(email, password); err != nil {
+		return 0, err
+	}
+	hPassword, err := a.ph.Hash(password)
 	if err != nil {
-		return 0, errors.Wrap(err, "failed to hash password")
+		return 0, err
 	}
 	id, err := a.us.CreateUser(ctx, email, hPassword)
 	if err != nil {
@@ -95,52 +299,306 @@ func (a *Auth) Register(ctx context.Context, email string, password string) (int
 		}
 		return 0, errors.Wrap(err, "failed create user")
 	}
+	err = a.audit(ctx, models.AuditRegister, id, "")
+	if err != nil {
+		return 0, err
+	}
+	err = a.sendVerification(ctx, id, email)
+	if err != nil {
+		return id, &VerificationNotSentError{Err: err}
+	}
 	return id, nil
 }
 
-func (a *Auth) Login(ctx context.Context, email string, password string) (*models.TokenPair, error) {
+// checkPassword returns a *PasswordPolicyError if the password does not
+// satisfy the password policy.
+func (a *Auth) checkPassword(email string, password string) error {
+	violations := a.pp.Validate(email, password)
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// Login checks the credentials. Failed attempts are counted per account
+// and per client address, too many of them lock the login for a while.
+// Users with MFA enabled get a challenge token to pass to VerifyMFA
+// instead of a token pair.
+func (a *Auth) Login(ctx context.Context, email string, password string) (*models.LoginResult, error) {
+	ip := reqctx.ClientIP(ctx)
+	if ip != "" {
+		if err := a.checkLoginLock(ctx, ipThrottleKey(ip)); err != nil {
+			return nil, a.loginRejected(ctx, 0, "client address is locked", err)
+		}
+	}
 	u, err := a.us.UserByEmail(ctx, email)
 	if err != nil {
 		if errors.Is(err, storage.ErrUserDoesNotExist) {
-			return nil, ErrInvalidLoginOrPassword
+			if err := a.loginFailed(ctx, nil); err != nil {
+				return nil, err
+			}
+			return nil, a.loginRejected(ctx, 0, "unknown email "+email, ErrInvalidLoginOrPassword)
 		}
 		return nil, errors.Wrap(err, "failed to get user by email")
 	}
-	err = bcrypt.CompareHashAndPassword([]byte(u.HPassword), []byte(password))
+	if err := a.checkLoginLock(ctx, userThrottleKey(u.Id)); err != nil {
+		return nil, a.loginRejected(ctx, u.Id, "account is locked", err)
+	}
+	err = a.ph.Compare([]byte(u.HPassword), password)
 	if err != nil {
-		return nil, ErrInvalidLoginOrPassword
+		if err := a.loginFailed(ctx, u); err != nil {
+			return nil, err
+		}
+		return nil, a.loginRejected(ctx, u.Id, "invalid password", ErrInvalidLoginOrPassword)
 	}
 	if u.IsBanned || u.IsDeleted {
-		return nil, ErrUserUnableToLogIn
+		return nil, a.loginRejected(ctx, u.Id, "user is deleted or banned", ErrUserUnableToLogIn)
+	}
+	if a.cfg.RequireVerifiedEmail && u.EmailVerifiedAt == nil {
+		return nil, a.loginRejected(ctx, u.Id, "email is not verified", ErrEmailNotVerified)
 	}
-	tp, err := a.t.NewPair(u.Email, u.Id, u.IsAdmin)
+	a.rehashPassword(ctx, u, password)
+	return a.completeLogin(ctx, u, "")
+}
+
+// completeLogin finishes a login that passed the first factor. Users with
+// MFA enabled get a challenge token instead of a token pair.
+func (a *Auth) completeLogin(ctx context.Context, u *models.User, method string) (*models.LoginResult, error) {
+	mfa, err := a.mfaEnabled(ctx, u.Id)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to create token pair")
+		return nil, err
 	}
-	return tp, nil
+	if mfa {
+		// The account failures are only reset by VerifyMFA, logging in
+		// again must not give more attempts at guessing the code.
+		token, err := a.t.NewMFAToken(u.Id)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create mfa token")
+		}
+		return &models.LoginResult{MFAToken: token}, nil
+	}
+	err = a.ls.ResetLoginThrottle(ctx, userThrottleKey(u.Id))
+	if err != nil {
+		return nil, err
+	}
+	err = a.audit(ctx, models.AuditLoginSucceeded, u.Id, method)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := a.newSession(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	return &models.LoginResult{Tokens: tokens}, nil
+}
+
+// loginRejected records the failed login and returns err.
+func (a *Auth) loginRejected(ctx context.Context, userId int64, reason string, err error) error {
+	if auditErr := a.audit(ctx, models.AuditLoginFailed, userId, reason); auditErr != nil {
+		return auditErr
+	}
+	return err
+}
+
+// rehashPassword upgrades a hash made with an outdated algorithm or
+// parameters. Failures are ignored, the old hash keeps working and the
+// upgrade is retried on the next login.
+func (a *Auth) rehashPassword(ctx context.Context, u *models.User, password string) {
+	if !a.ph.NeedsRehash([]byte(u.HPassword)) {
+		return
+	}
+	hPassword, err := a.ph.Hash(password)
+	if err != nil {
+		return
+	}
+	if err := a.us.UpdatePassword(ctx, u.Id, hPassword); err != nil {
+		return
+	}
+	u.HPassword = string(hPassword)
 }
 
+// Refresh exchanges a refresh token for a new pair. Every refresh token can
+// be used once, presenting a used token again revokes its whole family.
 func (a *Auth) Refresh(ctx context.Context, refreshToken string) (*models.TokenPair, error) {
-	id, err := a.t.ParseRefresh(refreshToken)
+	return a.refresh(ctx, refreshToken, "")
+}
+
+// refresh rotates the refresh token of a session. Sessions of OAuth
+// clients can only be refreshed by the client they were issued to,
+// clientId is empty for first-party sessions.
+func (a *Auth) refresh(ctx context.Context, refreshToken string, clientId string) (*models.TokenPair, error) {
+	claims, err := a.t.ParseRefresh(refreshToken)
 	if err != nil {
 		if errors.Is(err, jwt.ErrInvalidToken) {
 			return nil, ErrInvalidRefreshToken
 		}
 		return nil, errors.Wrap(err, "failed to parse refresh token")
 	}
-	u, err := a.us.UserByID(ctx, id)
+	rt, err := a.ts.RefreshTokenByHash(ctx, hashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, storage.ErrRefreshTokenNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, errors.Wrap(err, "failed to get refresh token")
+	}
+	if rt.RevokedAt != nil || rt.ClientId != clientId {
+		return nil, ErrInvalidRefreshToken
+	}
+	err = a.ts.UseRefreshToken(ctx, rt.Id)
+	if err != nil {
+		if errors.Is(err, storage.ErrRefreshTokenAlreadyUsed) {
+			if err := a.ts.RevokeRefreshTokenFamily(ctx, rt.FamilyId); err != nil {
+				return nil, errors.Wrap(err, "failed to revoke refresh token family")
+			}
+			if err := a.audit(ctx, models.AuditRefreshTokenReused, rt.UserId, "family "+rt.FamilyId); err != nil {
+				return nil, err
+			}
+			return nil, ErrRefreshTokenReused
+		}
+		return nil, errors.Wrap(err, "failed to use refresh token")
+	}
+	u, err := a.us.UserByID(ctx, rt.UserId)
 	if err != nil {
 		if errors.Is(err, storage.ErrUserDoesNotExist) {
 			return nil, ErrInvalidRefreshToken
 		}
 		return nil, errors.Wrap(err, "failed to get user by id")
 	}
+	revoked, err := a.tokenRevoked(ctx, u, claims)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrInvalidRefreshToken
+	}
 	if u.IsBanned || u.IsDeleted {
 		return nil, ErrUserUnableToLogIn
 	}
-	tp, err := a.t.NewPair(u.Email, u.Id, u.IsAdmin)
+	err = a.audit(ctx, models.AuditRefresh, u.Id, "")
+	if err != nil {
+		return nil, err
+	}
+	return a.issuePair(ctx, u, rt.Session())
+}
+
+// Introspect reports whether the access token is active, following RFC 7662.
+// A token is inactive if it does not verify, has expired or belongs to a
+// user who no longer exists or has been banned or deleted.
+func (a *Auth) Introspect(ctx context.Context, accessToken string) (*models.TokenIntrospection, error) {
+	claims, err := a.t.ParseAccess(accessToken)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to create token pair")
+		if errors.Is(err, jwt.ErrInvalidToken) {
+			return &models.TokenIntrospection{Active: false}, nil
+		}
+		return nil, errors.Wrap(err, "failed to parse access token")
+	}
+	if clientId, ok := claims.ServiceAccount(); ok {
+		return a.introspectServiceToken(ctx, clientId, claims)
+	}
+	u, err := a.tokenUser(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return &models.TokenIntrospection{Active: false}, nil
+	}
+	ti := &models.TokenIntrospection{
+		Active:      true,
+		UserId:      u.Id,
+		Email:       claims.Email,
+		IsAdmin:     claims.IsAdmin != nil && *claims.IsAdmin,
+		Roles:       claims.Roles,
+		Permissions: claims.Permissions,
+	}
+	if claims.ExpiresAt != nil {
+		ti.ExpiresAt = claims.ExpiresAt.Time
+	}
+	if claims.IssuedAt != nil {
+		ti.IssuedAt = claims.IssuedAt.Time
+	}
+	return ti, nil
+}
+
+// Authenticate checks the access token like Introspect and returns its
+// caller. Roles and permissions are loaded from storage, so changes apply
+// before the token expires.
+func (a *Auth) Authenticate(ctx context.Context, accessToken string) (*reqctx.Caller, error) {
+	claims, err := a.t.ParseAccess(accessToken)
+	if err != nil {
+		if errors.Is(err, jwt.ErrInvalidToken) {
+			return nil, ErrInvalidAccessToken
+		}
+		return nil, errors.Wrap(err, "failed to parse access token")
+	}
+	if clientId, ok := claims.ServiceAccount(); ok {
+		ti, err := a.introspectServiceToken(ctx, clientId, claims)
+		if err != nil {
+			return nil, err
+		}
+		if !ti.Active {
+			return nil, ErrInvalidAccessToken
+		}
+		return &reqctx.Caller{
+			ServiceAccount: clientId,
+			Permissions:    strings.Fields(ti.Scope),
+		}, nil
+	}
+	u, err := a.tokenUser(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return nil, ErrInvalidAccessToken
+	}
+	access, err := a.rs.UserAccess(ctx, u.Id)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get user access")
+	}
+	return &reqctx.Caller{
+		Id:          u.Id,
+		Email:       u.Email,
+		IsAdmin:     u.IsAdmin,
+		Roles:       access.Roles,
+		Permissions: access.Permissions,
+	}, nil
+}
+
+// tokenUser returns the user of the access token, nil if the user no
+// longer exists, is banned or deleted, or revoked the token.
+func (a *Auth) tokenUser(ctx context.Context, claims *jwt.Claims) (*models.User, error) {
+	u, err := a.us.UserByID(ctx, claims.Id)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserDoesNotExist) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "failed to get user by id")
+	}
+	if u.IsBanned || u.IsDeleted {
+		return nil, nil
+	}
+	revoked, err := a.tokenRevoked(ctx, u, claims)
+	if err != nil || revoked {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (a *Auth) JWKS() []models.JWK {
+	return a.t.JWKS()
+}
+
+// RotateSigningKey stores a new signing key. It verifies tokens at once
+// and signs them once every instance had time to sync it.
+func (a *Auth) RotateSigningKey(ctx context.Context) (string, error) {
+	if a.kr == nil {
+		return "", ErrKeyRotationUnavailable
+	}
+	kid, err := a.kr.Rotate(ctx)
+	if err != nil {
+		if errors.Is(err, storage.ErrSigningKeyPending) {
+			return "", ErrKeyRotationPending
+		}
+		return "", errors.Wrap(err, "failed to rotate signing key")
 	}
-	return tp, nil
+	return kid, nil
 }
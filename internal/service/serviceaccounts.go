@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/vindosVP/snauth/internal/jwt"
+	"github.com/vindosVP/snauth/internal/models"
+	"github.com/vindosVP/snauth/internal/reqctx"
+	"github.com/vindosVP/snauth/internal/storage"
+)
+
+type ServiceAccountStorage interface {
+	CreateServiceAccount(ctx context.Context, a *models.ServiceAccount) error
+	ServiceAccount(ctx context.Context, clientId string) (*models.ServiceAccount, error)
+	ServiceAccounts(ctx context.Context) ([]*models.ServiceAccount, error)
+	RotateServiceAccountSecret(ctx context.Context, clientId string, secretHash string, rotatedAt time.Time) error
+	DisableServiceAccount(ctx context.Context, clientId string, disabledAt time.Time) error
+}
+
+// CreateServiceAccount registers a service account and returns its
+// secret, which is only stored hashed. Scopes naming a permission let the
+// account call the RPCs requiring it, so the caller has to hold them.
+func (a *Auth) CreateServiceAccount(ctx context.Context, name string, scopes []string) (*models.ServiceAccount, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", ErrInvalidServiceAccountName
+	}
+	granted := make([]string, 0, len(scopes))
+	for _, s := range scopes {
+		if !validScope(s) {
+			return nil, "", ErrInvalidServiceScope
+		}
+		if slices.Contains(granted, s) {
+			continue
+		}
+		if slices.Contains(models.Permissions, s) && !callerCan(ctx, s) {
+			return nil, "", ErrScopeNotHeld
+		}
+		granted = append(granted, s)
+	}
+	clientId, err := randomToken()
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to generate client id")
+	}
+	secret, err := newClientSecret()
+	if err != nil {
+		return nil, "", err
+	}
+	sa := &models.ServiceAccount{
+		ClientId:   clientId,
+		Name:       name,
+		SecretHash: hashToken(secret),
+		Scopes:     granted,
+	}
+	err = a.sa.CreateServiceAccount(ctx, sa)
+	if err != nil {
+		return nil, "", err
+	}
+	err = a.audit(ctx, models.AuditServiceAccountCreated, 0, "service account "+sa.ClientId)
+	if err != nil {
+		return nil, "", err
+	}
+	return sa, secret, nil
+}
+
+func (a *Auth) ListServiceAccounts(ctx context.Context) ([]*models.ServiceAccount, error) {
+	return a.sa.ServiceAccounts(ctx)
+}
+
+// RotateServiceAccountSecret replaces the secret of the account. Tokens
+// issued up to the rotation are reported inactive by Introspect.
+func (a *Auth) RotateServiceAccountSecret(ctx context.Context, clientId string) (string, error) {
+	sa, err := a.serviceAccount(ctx, clientId)
+	if err != nil {
+		return "", err
+	}
+	if sa.Disabled() {
+		return "", ErrServiceAccountDisabled
+	}
+	secret, err := newClientSecret()
+	if err != nil {
+		return "", err
+	}
+	err = a.sa.RotateServiceAccountSecret(ctx, clientId, hashToken(secret), time.Now())
+	if err != nil {
+		if errors.Is(err, storage.ErrServiceAccountDoesNotExist) {
+			return "", ErrServiceAccountDoesNotExist
+		}
+		return "", err
+	}
+	err = a.audit(ctx, models.AuditServiceAccountRotated, 0, "service account "+clientId)
+	if err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// DisableServiceAccount stops the account from getting tokens, the tokens
+// it holds are reported inactive by Introspect.
+func (a *Auth) DisableServiceAccount(ctx context.Context, clientId string) error {
+	err := a.sa.DisableServiceAccount(ctx, clientId, time.Now())
+	if err != nil {
+		if errors.Is(err, storage.ErrServiceAccountDoesNotExist) {
+			return ErrServiceAccountDoesNotExist
+		}
+		return err
+	}
+	return a.audit(ctx, models.AuditServiceAccountDisabled, 0, "service account "+clientId)
+}
+
+// IssueServiceToken implements the client credentials grant. An empty
+// scope requests every scope of the account.
+func (a *Auth) IssueServiceToken(ctx context.Context, clientId string, clientSecret string, scope string) (*models.ServiceToken, error) {
+	sa, err := a.sa.ServiceAccount(ctx, clientId)
+	if err != nil {
+		if errors.Is(err, storage.ErrServiceAccountDoesNotExist) {
+			return nil, ErrInvalidServiceCredentials
+		}
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashToken(clientSecret)), []byte(sa.SecretHash)) != 1 || sa.Disabled() {
+		return nil, ErrInvalidServiceCredentials
+	}
+	// Token timestamps have second precision, a token issued in the second
+	// of the rotation could not be told apart from one issued before it.
+	if sa.SecretRotatedAt != nil && !time.Now().Truncate(time.Second).After(*sa.SecretRotatedAt) {
+		return nil, ErrSecretJustRotated
+	}
+	granted := sa.Scopes
+	if requested := strings.Fields(scope); len(requested) > 0 {
+		granted = make([]string, 0, len(requested))
+		for _, s := range requested {
+			if !slices.Contains(sa.Scopes, s) {
+				return nil, ErrScopeNotGranted
+			}
+			if !slices.Contains(granted, s) {
+				granted = append(granted, s)
+			}
+		}
+	}
+	token, err := a.t.NewServiceToken(sa.ClientId, strings.Join(granted, " "))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create service token")
+	}
+	return token, nil
+}
+
+// introspectServiceToken reports tokens of disabled accounts and tokens
+// issued up to the last secret rotation inactive. The rotation time is
+// exact while iat has second precision, so tokens of the second of the
+// rotation are inactive as well.
+func (a *Auth) introspectServiceToken(ctx context.Context, clientId string, claims *jwt.Claims) (*models.TokenIntrospection, error) {
+	sa, err := a.sa.ServiceAccount(ctx, clientId)
+	if err != nil {
+		if errors.Is(err, storage.ErrServiceAccountDoesNotExist) {
+			return &models.TokenIntrospection{Active: false}, nil
+		}
+		return nil, err
+	}
+	if sa.Disabled() || claims.IssuedAt == nil {
+		return &models.TokenIntrospection{Active: false}, nil
+	}
+	if sa.SecretRotatedAt != nil && !claims.IssuedAt.Time.After(*sa.SecretRotatedAt) {
+		return &models.TokenIntrospection{Active: false}, nil
+	}
+	ti := &models.TokenIntrospection{
+		Active:         true,
+		ServiceAccount: sa.ClientId,
+		Scope:          claims.Scope,
+		IssuedAt:       claims.IssuedAt.Time,
+	}
+	if claims.ExpiresAt != nil {
+		ti.ExpiresAt = claims.ExpiresAt.Time
+	}
+	return ti, nil
+}
+
+func (a *Auth) serviceAccount(ctx context.Context, clientId string) (*models.ServiceAccount, error) {
+	sa, err := a.sa.ServiceAccount(ctx, clientId)
+	if err != nil {
+		if errors.Is(err, storage.ErrServiceAccountDoesNotExist) {
+			return nil, ErrServiceAccountDoesNotExist
+		}
+		return nil, err
+	}
+	return sa, nil
+}
+
+// callerCan reports whether the caller of the request holds the
+// permission.
+func callerCan(ctx context.Context, permission string) bool {
+	c, ok := reqctx.CallerFromContext(ctx)
+	return ok && c.Can(permission)
+}
+
+// validScope accepts the scope tokens of RFC 6749, printable ASCII
+// without spaces, double quotes and backslashes.
+func validScope(scope string) bool {
+	if scope == "" {
+		return false
+	}
+	for _, r := range scope {
+		if r < 0x21 || r > 0x7e || r == '"' || r == '\\' {
+			return false
+		}
+	}
+	return true
+}
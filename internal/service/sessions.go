@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/vindosVP/snauth/internal/jwt"
+	"github.com/vindosVP/snauth/internal/models"
+	"github.com/vindosVP/snauth/internal/storage"
+)
+
+type TokenStorage interface {
+	SaveRefreshToken(ctx context.Context, t *models.RefreshToken) error
+	RefreshTokenByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error)
+	UseRefreshToken(ctx context.Context, id int64) error
+	RevokeRefreshTokenFamily(ctx context.Context, familyId string) error
+	RevokeUserRefreshTokens(ctx context.Context, userId int64) error
+	RefreshTokenFamilyActive(ctx context.Context, familyId string) (bool, error)
+	SaveOneTimeToken(ctx context.Context, t *models.OneTimeToken) error
+	OneTimeToken(ctx context.Context, purpose string, tokenHash string) (*models.OneTimeToken, error)
+	UseOneTimeToken(ctx context.Context, purpose string, tokenHash string) (*models.OneTimeToken, error)
+	InvalidateOneTimeTokens(ctx context.Context, userId int64, purpose string) error
+}
+
+// Logout ends the session the refresh token belongs to.
+func (a *Auth) Logout(ctx context.Context, refreshToken string) error {
+	_, err := a.t.ParseRefresh(refreshToken)
+	if err != nil {
+		if errors.Is(err, jwt.ErrInvalidToken) {
+			return ErrInvalidRefreshToken
+		}
+		return errors.Wrap(err, "failed to parse refresh token")
+	}
+	rt, err := a.ts.RefreshTokenByHash(ctx, hashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, storage.ErrRefreshTokenNotFound) {
+			return ErrInvalidRefreshToken
+		}
+		return errors.Wrap(err, "failed to get refresh token")
+	}
+	err = a.ts.RevokeRefreshTokenFamily(ctx, rt.FamilyId)
+	if err != nil {
+		return errors.Wrap(err, "failed to revoke refresh token family")
+	}
+	return nil
+}
+
+// LogoutAll ends every session of the user.
+func (a *Auth) LogoutAll(ctx context.Context, userId int64) error {
+	err := a.revokeSessions(ctx, userId, models.RevocationReasonLogout)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserDoesNotExist) {
+			return ErrUserDoesNotExist
+		}
+		return err
+	}
+	return nil
+}
+
+// SubscribeRevocations streams session revocations to token verifiers.
+func (a *Auth) SubscribeRevocations() (<-chan models.RevocationEvent, func()) {
+	return a.rb.Subscribe()
+}
+
+// revokeSessions revokes every refresh token of the user, rejects all
+// tokens issued until now and notifies subscribed verifiers.
+func (a *Auth) revokeSessions(ctx context.Context, userId int64, reason string) error {
+	// Token timestamps have second precision, so the cutoff has as well.
+	cutoff := time.Now().Truncate(time.Second)
+	err := a.us.SetTokensValidAfter(ctx, userId, cutoff)
+	if err != nil {
+		return errors.Wrap(err, "failed to set tokens valid after")
+	}
+	err = a.ts.RevokeUserRefreshTokens(ctx, userId)
+	if err != nil {
+		return errors.Wrap(err, "failed to revoke refresh tokens")
+	}
+	a.rb.Publish(models.RevocationEvent{UserId: userId, RevokedAt: cutoff, Reason: reason})
+	return nil
+}
+
+// tokenRevoked reports whether the token was issued before the user
+// logged out of every session. Tokens issued in the second of the cutoff
+// are revoked unless their session was started after it, which is the
+// case if the session was not revoked with the others.
+func (a *Auth) tokenRevoked(ctx context.Context, u *models.User, claims *jwt.Claims) (bool, error) {
+	if u.TokensValidAfter == nil {
+		return false, nil
+	}
+	if claims.IssuedAt == nil {
+		return true, nil
+	}
+	if claims.IssuedAt.Time.After(*u.TokensValidAfter) {
+		return false, nil
+	}
+	if claims.SessionId == "" || claims.IssuedAt.Time.Before(*u.TokensValidAfter) {
+		return true, nil
+	}
+	active, err := a.ts.RefreshTokenFamilyActive(ctx, claims.SessionId)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to check session")
+	}
+	return !active, nil
+}
+
+// issuePair creates a token pair for the user and stores the refresh token
+// as the newest member of the session family. Sessions of OAuth clients
+// get tokens limited to their scope.
+func (a *Auth) issuePair(ctx context.Context, u *models.User, s models.Session) (*models.TokenPair, error) {
+	var tp *models.TokenPair
+	if s.ClientId != "" {
+		var err error
+		tp, err = a.t.NewOAuthPair(u.Id, s)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create token pair")
+		}
+	} else {
+		access, err := a.rs.UserAccess(ctx, u.Id)
+		if err != nil {
+			return nil, err
+		}
+		tp, err = a.t.NewPair(u.Email, u.Id, u.IsAdmin, *access, s)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create token pair")
+		}
+	}
+	err := a.ts.SaveRefreshToken(ctx, &models.RefreshToken{
+		UserId:    u.Id,
+		FamilyId:  s.Id,
+		ClientId:  s.ClientId,
+		Scope:     s.Scope,
+		TokenHash: hashToken(tp.RefreshToken),
+		AuthTime:  s.AuthTime,
+		ExpiresAt: tp.RefreshExpiresAt,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to save refresh token")
+	}
+	return tp, nil
+}
+
+// newSession starts a new refresh token family for the user, who just
+// authenticated.
+func (a *Auth) newSession(ctx context.Context, u *models.User) (*models.TokenPair, error) {
+	return a.startSession(ctx, u, models.Session{AuthTime: time.Now()})
+}
+
+// startSession assigns the session a new family id and issues its first
+// token pair.
+func (a *Auth) startSession(ctx context.Context, u *models.User, s models.Session) (*models.TokenPair, error) {
+	familyId, err := randomToken()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate session id")
+	}
+	s.Id = familyId
+	return a.issuePair(ctx, u, s)
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
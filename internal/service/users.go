@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/vindosVP/snauth/internal/models"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+type pageToken struct {
+	SortBy    string    `json:"s"`
+	Id        int64     `json:"i"`
+	CreatedAt time.Time `json:"c"`
+}
+
+// ListUsers returns one page of users matching the filter together with
+// the total number of matching users. Pages are keyed by the last user of
+// the previous page, so inserts do not shift them.
+func (a *Auth) ListUsers(ctx context.Context, q models.ListUsersQuery) (*models.UserList, error) {
+	sortBy := q.SortBy
+	if sortBy == "" {
+		sortBy = models.UserSortById
+	}
+	if sortBy != models.UserSortById && sortBy != models.UserSortByCreatedAt {
+		return nil, ErrInvalidSortField
+	}
+	page := models.UserPage{SortBy: sortBy, Descending: q.Descending, Limit: pageSize(q.PageSize)}
+	if q.PageToken != "" {
+		after, err := decodePageToken(q.PageToken, sortBy)
+		if err != nil {
+			return nil, err
+		}
+		page.After = after
+	}
+	// One extra user tells whether there is a next page.
+	page.Limit++
+	users, err := a.us.ListUsers(ctx, q.Filter, page)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list users")
+	}
+	total, err := a.us.CountUsers(ctx, q.Filter)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to count users")
+	}
+	list := &models.UserList{Users: users, Total: total}
+	if len(users) == page.Limit {
+		list.Users = users[:len(users)-1]
+		last := list.Users[len(list.Users)-1]
+		list.NextPageToken = encodePageToken(pageToken{SortBy: sortBy, Id: last.Id, CreatedAt: last.CreatedAt})
+	}
+	return list, nil
+}
+
+func pageSize(size int) int {
+	if size <= 0 {
+		return defaultPageSize
+	}
+	return min(size, maxPageSize)
+}
+
+func encodePageToken(t pageToken) string {
+	b, _ := json.Marshal(t)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodePageToken(s string, sortBy string) (*models.UserCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidPageToken
+	}
+	var t pageToken
+	if err := json.Unmarshal(b, &t); err != nil {
+		return nil, ErrInvalidPageToken
+	}
+	if t.SortBy != sortBy {
+		return nil, ErrInvalidPageToken
+	}
+	return &models.UserCursor{Id: t.Id, CreatedAt: t.CreatedAt}, nil
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/vindosVP/snauth/internal/models"
+	"github.com/vindosVP/snauth/internal/storage"
+)
+
+// VerifyEmail consumes the verification token and marks the email of its
+// user as verified.
+func (a *Auth) VerifyEmail(ctx context.Context, token string) error {
+	t, err := a.ts.UseOneTimeToken(ctx, models.TokenPurposeEmailVerification, hashToken(token))
+	if err != nil {
+		if errors.Is(err, storage.ErrOneTimeTokenInvalid) {
+			return ErrInvalidVerificationToken
+		}
+		return errors.Wrap(err, "failed to use verification token")
+	}
+	err = a.us.SetEmailVerified(ctx, t.UserId, time.Now())
+	if err != nil {
+		if errors.Is(err, storage.ErrUserDoesNotExist) {
+			return ErrInvalidVerificationToken
+		}
+		return errors.Wrap(err, "failed to set email verified")
+	}
+	err = a.ts.InvalidateOneTimeTokens(ctx, t.UserId, models.TokenPurposeEmailVerification)
+	if err != nil {
+		return errors.Wrap(err, "failed to invalidate verification tokens")
+	}
+	return nil
+}
+
+// ResendVerification sends a new verification token. Unknown and already
+// verified accounts are silently skipped. At most VerificationResendLimit
+// requests are accepted per email and VerificationResendWindow, whether
+// an account exists or not.
+func (a *Auth) ResendVerification(ctx context.Context, email string) error {
+	limited, err := a.requestLimited(ctx, "verification:"+strings.ToLower(strings.TrimSpace(email)), a.cfg.VerificationResendLimit, a.cfg.VerificationResendWindow)
+	if err != nil {
+		return err
+	}
+	if limited {
+		return ErrTooManyVerificationRequests
+	}
+	u, err := a.us.UserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserDoesNotExist) {
+			return nil
+		}
+		return errors.Wrap(err, "failed to get user by email")
+	}
+	if u.EmailVerifiedAt != nil || u.IsDeleted {
+		return nil
+	}
+	return a.sendVerification(ctx, u.Id, u.Email)
+}
+
+func (a *Auth) sendVerification(ctx context.Context, userId int64, email string) error {
+	token, err := a.issueOneTimeToken(ctx, userId, models.TokenPurposeEmailVerification, a.cfg.VerificationTTL)
+	if err != nil {
+		return err
+	}
+	err = a.n.Notify(ctx, models.Message{
+		To:      email,
+		Subject: "Email verification",
+		Body:    tokenBody("email verification", a.cfg.VerificationURL, token),
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to send verification token")
+	}
+	return nil
+}
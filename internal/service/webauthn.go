@@ -0,0 +1,373 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/pkg/errors"
+
+	"github.com/vindosVP/snauth/internal/models"
+	"github.com/vindosVP/snauth/internal/reqctx"
+	"github.com/vindosVP/snauth/internal/storage"
+)
+
+const (
+	defaultCredentialName = "passkey"
+	maxCredentialName     = 64
+)
+
+type WebAuthnStorage interface {
+	SaveWebAuthnCredential(ctx context.Context, c *models.WebAuthnCredential) error
+	WebAuthnCredentials(ctx context.Context, userId int64) ([]*models.WebAuthnCredential, error)
+	UpdateWebAuthnCredentialUse(ctx context.Context, credentialId []byte, signCount uint32, backupState bool) error
+	SaveWebAuthnSession(ctx context.Context, ws *models.WebAuthnSession) error
+	UseWebAuthnSession(ctx context.Context, ceremony string, tokenHash string) (*models.WebAuthnSession, error)
+}
+
+// RelyingParty runs the WebAuthn ceremonies, *webauthn.WebAuthn
+// implements it.
+type RelyingParty interface {
+	BeginRegistration(user webauthn.User, opts ...webauthn.RegistrationOption) (*protocol.CredentialCreation, *webauthn.SessionData, error)
+	CreateCredential(user webauthn.User, session webauthn.SessionData, parsedResponse *protocol.ParsedCredentialCreationData) (*webauthn.Credential, error)
+	BeginLogin(user webauthn.User, opts ...webauthn.LoginOption) (*protocol.CredentialAssertion, *webauthn.SessionData, error)
+	ValidateLogin(user webauthn.User, session webauthn.SessionData, parsedResponse *protocol.ParsedCredentialAssertionData) (*webauthn.Credential, error)
+}
+
+// BeginWebAuthnRegistration starts registering a new passkey or security
+// key for the user. Credentials the user already has are excluded.
+func (a *Auth) BeginWebAuthnRegistration(ctx context.Context, userId int64) (*models.WebAuthnChallenge, error) {
+	if a.rp == nil {
+		return nil, ErrWebAuthnUnavailable
+	}
+	user, err := a.webAuthnUser(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(user.credentials))
+	for _, c := range user.credentials {
+		exclusions = append(exclusions, c.Descriptor())
+	}
+	creation, session, err := a.rp.BeginRegistration(user,
+		webauthn.WithExclusions(exclusions),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to begin webauthn registration")
+	}
+	return a.startWebAuthnSession(ctx, userId, models.WebAuthnCeremonyRegistration, session, creation)
+}
+
+// FinishWebAuthnRegistration verifies the attestation the authenticator
+// returned and stores the new credential.
+func (a *Auth) FinishWebAuthnRegistration(ctx context.Context, userId int64, sessionToken string, name string, response []byte) (*models.WebAuthnCredential, error) {
+	if a.rp == nil {
+		return nil, ErrWebAuthnUnavailable
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = defaultCredentialName
+	}
+	if len(name) > maxCredentialName {
+		return nil, ErrInvalidCredentialName
+	}
+	session, err := a.useWebAuthnSession(ctx, models.WebAuthnCeremonyRegistration, sessionToken)
+	if err != nil {
+		return nil, err
+	}
+	if session.UserId != userId {
+		return nil, ErrInvalidWebAuthnSession
+	}
+	user, err := a.webAuthnUser(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(response))
+	if err != nil {
+		return nil, ErrInvalidWebAuthnResponse
+	}
+	cred, err := a.rp.CreateCredential(user, *session.data, parsed)
+	if err != nil {
+		return nil, ErrInvalidWebAuthnResponse
+	}
+	transports := make([]string, 0, len(cred.Transport))
+	for _, t := range cred.Transport {
+		transports = append(transports, string(t))
+	}
+	c := &models.WebAuthnCredential{
+		UserId:          userId,
+		CredentialId:    cred.ID,
+		Name:            name,
+		PublicKey:       cred.PublicKey,
+		AttestationType: cred.AttestationType,
+		Transports:      transports,
+		AAGUID:          cred.Authenticator.AAGUID,
+		SignCount:       cred.Authenticator.SignCount,
+		BackupEligible:  cred.Flags.BackupEligible,
+		BackupState:     cred.Flags.BackupState,
+	}
+	err = a.ws.SaveWebAuthnCredential(ctx, c)
+	if err != nil {
+		if errors.Is(err, storage.ErrWebAuthnCredentialExists) {
+			return nil, ErrWebAuthnCredentialExists
+		}
+		return nil, err
+	}
+	err = a.audit(ctx, models.AuditWebAuthnRegistered, userId, name)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// BeginWebAuthnLogin starts an assertion with the credentials of the user.
+// Unknown emails and users without credentials get a challenge for a decoy
+// credential, so the response does not tell whether an account has
+// passkeys.
+func (a *Auth) BeginWebAuthnLogin(ctx context.Context, email string) (*models.WebAuthnChallenge, error) {
+	if a.rp == nil {
+		return nil, ErrWebAuthnUnavailable
+	}
+	user, err := a.webAuthnLoginUser(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	// A passkey replaces the password and the second factor, so the
+	// authenticator has to verify the user with a PIN or biometric.
+	assertion, session, err := a.rp.BeginLogin(user, webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to begin webauthn login")
+	}
+	return a.startWebAuthnSession(ctx, user.u.Id, models.WebAuthnCeremonyLogin, session, assertion)
+}
+
+func (a *Auth) webAuthnLoginUser(ctx context.Context, email string) (*webAuthnUser, error) {
+	u, err := a.us.UserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserDoesNotExist) {
+			return a.decoyWebAuthnUser(email), nil
+		}
+		return nil, errors.Wrap(err, "failed to get user by email")
+	}
+	user, err := a.webAuthnUser(ctx, u.Id)
+	if err != nil {
+		return nil, err
+	}
+	if len(user.credentials) == 0 {
+		return a.decoyWebAuthnUser(email), nil
+	}
+	return user, nil
+}
+
+// decoyWebAuthnUser returns a user without an id and with a credential no
+// authenticator holds. The credential id is derived from the email, so
+// repeated logins offer the same one like they do for real accounts.
+func (a *Auth) decoyWebAuthnUser(email string) *webAuthnUser {
+	mac := hmac.New(sha256.New, a.cfg.WebAuthnDecoyKey)
+	mac.Write([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return &webAuthnUser{
+		u: &models.User{Email: email},
+		credentials: []webauthn.Credential{{
+			ID:        mac.Sum(nil),
+			Transport: []protocol.AuthenticatorTransport{protocol.Internal, protocol.Hybrid},
+		}},
+	}
+}
+
+// FinishWebAuthnLogin verifies the assertion and issues a token pair the
+// same way Login does. A passkey replaces both the password and the
+// second factor. Failed assertions count towards the login lockout.
+func (a *Auth) FinishWebAuthnLogin(ctx context.Context, sessionToken string, response []byte) (*models.TokenPair, error) {
+	if a.rp == nil {
+		return nil, ErrWebAuthnUnavailable
+	}
+	if ip := reqctx.ClientIP(ctx); ip != "" {
+		if err := a.checkLoginLock(ctx, ipThrottleKey(ip)); err != nil {
+			return nil, a.loginRejected(ctx, 0, "client address is locked", err)
+		}
+	}
+	session, err := a.useWebAuthnSession(ctx, models.WebAuthnCeremonyLogin, sessionToken)
+	if err != nil {
+		return nil, err
+	}
+	if session.UserId == 0 {
+		if err := a.loginFailed(ctx, nil); err != nil {
+			return nil, err
+		}
+		return nil, a.loginRejected(ctx, 0, "webauthn login for an account without credentials", ErrInvalidWebAuthnResponse)
+	}
+	user, err := a.webAuthnUser(ctx, session.UserId)
+	if err != nil {
+		if errors.Is(err, ErrUserDoesNotExist) {
+			return nil, ErrInvalidWebAuthnSession
+		}
+		return nil, err
+	}
+	u := user.u
+	if err := a.checkLoginLock(ctx, userThrottleKey(u.Id)); err != nil {
+		return nil, a.loginRejected(ctx, u.Id, "account is locked", err)
+	}
+	cred, err := a.validateAssertion(user, session.data, response)
+	if err == nil && !cred.Flags.UserVerified {
+		err = ErrInvalidWebAuthnResponse
+	}
+	if err != nil {
+		if err := a.loginFailed(ctx, u); err != nil {
+			return nil, err
+		}
+		return nil, a.loginRejected(ctx, u.Id, "invalid webauthn assertion", ErrInvalidWebAuthnResponse)
+	}
+	if cred.Authenticator.CloneWarning {
+		return nil, a.loginRejected(ctx, u.Id, "webauthn sign count went back, authenticator may be cloned", ErrInvalidWebAuthnResponse)
+	}
+	err = a.ws.UpdateWebAuthnCredentialUse(ctx, cred.ID, cred.Authenticator.SignCount, cred.Flags.BackupState)
+	if err != nil {
+		if errors.Is(err, storage.ErrWebAuthnCredentialNotFound) {
+			return nil, a.loginRejected(ctx, u.Id, "webauthn credential was removed", ErrInvalidWebAuthnResponse)
+		}
+		return nil, err
+	}
+	if u.IsBanned || u.IsDeleted {
+		return nil, a.loginRejected(ctx, u.Id, "user is deleted or banned", ErrUserUnableToLogIn)
+	}
+	if a.cfg.RequireVerifiedEmail && u.EmailVerifiedAt == nil {
+		return nil, a.loginRejected(ctx, u.Id, "email is not verified", ErrEmailNotVerified)
+	}
+	err = a.ls.ResetLoginThrottle(ctx, userThrottleKey(u.Id))
+	if err != nil {
+		return nil, err
+	}
+	err = a.audit(ctx, models.AuditLoginSucceeded, u.Id, "webauthn")
+	if err != nil {
+		return nil, err
+	}
+	return a.newSession(ctx, u)
+}
+
+func (a *Auth) validateAssertion(user *webAuthnUser, session *webauthn.SessionData, response []byte) (*webauthn.Credential, error) {
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(response))
+	if err != nil {
+		return nil, err
+	}
+	return a.rp.ValidateLogin(user, *session, parsed)
+}
+
+type webAuthnSession struct {
+	*models.WebAuthnSession
+	data *webauthn.SessionData
+}
+
+// startWebAuthnSession stores the session data of a ceremony and returns
+// the options for the client together with the token to finish it with.
+func (a *Auth) startWebAuthnSession(ctx context.Context, userId int64, ceremony string, session *webauthn.SessionData, options any) (*models.WebAuthnChallenge, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode webauthn session")
+	}
+	opts, err := json.Marshal(options)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode webauthn options")
+	}
+	token, err := randomToken()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate webauthn session token")
+	}
+	err = a.ws.SaveWebAuthnSession(ctx, &models.WebAuthnSession{
+		UserId:    userId,
+		Ceremony:  ceremony,
+		TokenHash: hashToken(token),
+		Data:      data,
+		ExpiresAt: time.Now().Add(a.cfg.WebAuthnSessionTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &models.WebAuthnChallenge{SessionToken: token, Options: opts}, nil
+}
+
+func (a *Auth) useWebAuthnSession(ctx context.Context, ceremony string, token string) (*webAuthnSession, error) {
+	ws, err := a.ws.UseWebAuthnSession(ctx, ceremony, hashToken(token))
+	if err != nil {
+		if errors.Is(err, storage.ErrWebAuthnSessionInvalid) {
+			return nil, ErrInvalidWebAuthnSession
+		}
+		return nil, err
+	}
+	data := &webauthn.SessionData{}
+	err = json.Unmarshal(ws.Data, data)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode webauthn session")
+	}
+	return &webAuthnSession{WebAuthnSession: ws, data: data}, nil
+}
+
+// webAuthnUser is a user together with its credentials as the WebAuthn
+// library expects it.
+type webAuthnUser struct {
+	u           *models.User
+	credentials []webauthn.Credential
+}
+
+func (a *Auth) webAuthnUser(ctx context.Context, userId int64) (*webAuthnUser, error) {
+	u, err := a.us.UserByID(ctx, userId)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserDoesNotExist) {
+			return nil, ErrUserDoesNotExist
+		}
+		return nil, errors.Wrap(err, "failed to get user by id")
+	}
+	stored, err := a.ws.WebAuthnCredentials(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	credentials := make([]webauthn.Credential, 0, len(stored))
+	for _, c := range stored {
+		transports := make([]protocol.AuthenticatorTransport, 0, len(c.Transports))
+		for _, t := range c.Transports {
+			transports = append(transports, protocol.AuthenticatorTransport(t))
+		}
+		credentials = append(credentials, webauthn.Credential{
+			ID:              c.CredentialId,
+			PublicKey:       c.PublicKey,
+			AttestationType: c.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: c.BackupEligible,
+				BackupState:    c.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    c.AAGUID,
+				SignCount: c.SignCount,
+			},
+		})
+	}
+	return &webAuthnUser{u: u, credentials: credentials}, nil
+}
+
+// WebAuthnID is the user handle, the big endian user id.
+func (w *webAuthnUser) WebAuthnID() []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(w.u.Id))
+}
+
+func (w *webAuthnUser) WebAuthnName() string {
+	return w.u.Email
+}
+
+func (w *webAuthnUser) WebAuthnDisplayName() string {
+	return w.u.Email
+}
+
+func (w *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return w.credentials
+}
+
+func (w *webAuthnUser) WebAuthnIcon() string {
+	return ""
+}
@@ -0,0 +1,325 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/go-webauthn/webauthn/webauthn"
+
+	"github.com/vindosVP/snauth/internal/models"
+)
+
+const (
+	testRPID   = "example.com"
+	testOrigin = "https://example.com"
+)
+
+// softAuthenticator is a platform authenticator with a single P-256 key
+// that attests with the "none" format.
+type softAuthenticator struct {
+	t         *testing.T
+	key       *ecdsa.PrivateKey
+	id        []byte
+	userId    []byte
+	signCount uint32
+	// skipUV leaves out user verification from assertions, like an
+	// authenticator without a PIN or biometric.
+	skipUV bool
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		t.Fatal(err)
+	}
+	return &softAuthenticator{t: t, key: key, id: id}
+}
+
+func (sa *softAuthenticator) authData(flags protocol.AuthenticatorFlags, attested []byte) []byte {
+	rpIdHash := sha256.Sum256([]byte(testRPID))
+	data := append(rpIdHash[:], byte(flags))
+	data = binary.BigEndian.AppendUint32(data, sa.signCount)
+	return append(data, attested...)
+}
+
+func (sa *softAuthenticator) clientData(typ protocol.CeremonyType, challenge protocol.URLEncodedBase64) []byte {
+	data, err := json.Marshal(protocol.CollectedClientData{
+		Type:      typ,
+		Challenge: base64.RawURLEncoding.EncodeToString(challenge),
+		Origin:    testOrigin,
+	})
+	if err != nil {
+		sa.t.Fatal(err)
+	}
+	return data
+}
+
+// create answers navigator.credentials.create() with the options of a
+// registration challenge.
+func (sa *softAuthenticator) create(options []byte) []byte {
+	var creation protocol.CredentialCreation
+	if err := json.Unmarshal(options, &creation); err != nil {
+		sa.t.Fatal(err)
+	}
+	userId, err := base64.RawURLEncoding.DecodeString(creation.Response.User.ID.(string))
+	if err != nil {
+		sa.t.Fatal(err)
+	}
+	sa.userId = userId
+	cose, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  1,
+		XCoord: sa.key.X.FillBytes(make([]byte, 32)),
+		YCoord: sa.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		sa.t.Fatal(err)
+	}
+	attested := make([]byte, 16)
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(sa.id)))
+	attested = append(attested, sa.id...)
+	attested = append(attested, cose...)
+	attestation, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": sa.authData(protocol.FlagUserPresent|protocol.FlagUserVerified|protocol.FlagAttestedCredentialData, attested),
+	})
+	if err != nil {
+		sa.t.Fatal(err)
+	}
+	return sa.marshal(map[string]any{
+		"clientDataJSON":    encode(sa.clientData(protocol.CreateCeremony, creation.Response.Challenge)),
+		"attestationObject": encode(attestation),
+	})
+}
+
+// get answers navigator.credentials.get() with the options of a login
+// challenge.
+func (sa *softAuthenticator) get(options []byte) []byte {
+	var assertion protocol.CredentialAssertion
+	if err := json.Unmarshal(options, &assertion); err != nil {
+		sa.t.Fatal(err)
+	}
+	sa.signCount++
+	flags := protocol.FlagUserPresent | protocol.FlagUserVerified
+	if sa.skipUV {
+		flags = protocol.FlagUserPresent
+	}
+	authData := sa.authData(flags, nil)
+	clientData := sa.clientData(protocol.AssertCeremony, assertion.Response.Challenge)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(authData, clientDataHash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, sa.key, digest[:])
+	if err != nil {
+		sa.t.Fatal(err)
+	}
+	return sa.marshal(map[string]any{
+		"clientDataJSON":    encode(clientData),
+		"authenticatorData": encode(authData),
+		"signature":         encode(sig),
+		"userHandle":        encode(sa.userId),
+	})
+}
+
+func (sa *softAuthenticator) marshal(response map[string]any) []byte {
+	data, err := json.Marshal(map[string]any{
+		"id":       encode(sa.id),
+		"rawId":    encode(sa.id),
+		"type":     "public-key",
+		"response": response,
+	})
+	if err != nil {
+		sa.t.Fatal(err)
+	}
+	return data
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func newWebAuthnTestAuth(t *testing.T, s *fakeStorage) *Auth {
+	rp, err := webauthn.New(&webauthn.Config{
+		RPID:          testRPID,
+		RPDisplayName: "snauth",
+		RPOrigins:     []string{testOrigin},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(Deps{
+		Users:         s,
+		Tokens:        s,
+		LoginThrottle: s,
+		Audit:         s,
+		Roles:         s,
+		WebAuthn:      s,
+		TokenProvider: fakeTokenProvider{},
+		RelyingParty:  rp,
+	}, Config{
+		LoginMaxFailures:   5,
+		LoginMaxIPFailures: 20,
+		LoginFailureWindow: time.Hour,
+		LoginLockout:       time.Minute,
+		LoginMaxLockout:    time.Hour,
+		WebAuthnSessionTTL: time.Minute,
+		WebAuthnDecoyKey:   []byte("decoy key"),
+	})
+}
+
+func allowedCredentials(t *testing.T, options []byte) []protocol.CredentialDescriptor {
+	var assertion protocol.CredentialAssertion
+	if err := json.Unmarshal(options, &assertion); err != nil {
+		t.Fatal(err)
+	}
+	return assertion.Response.AllowedCredentials
+}
+
+func TestWebAuthnCeremonies(t *testing.T) {
+	ctx := context.Background()
+	s := newFakeStorage(&models.User{Id: 1, Email: "user@example.com"})
+	a := newWebAuthnTestAuth(t, s)
+	sa := newSoftAuthenticator(t)
+
+	c, err := a.BeginWebAuthnRegistration(ctx, 1)
+	if err != nil {
+		t.Fatalf("begin registration: %v", err)
+	}
+	cred, err := a.FinishWebAuthnRegistration(ctx, 1, c.SessionToken, "laptop", sa.create(c.Options))
+	if err != nil {
+		t.Fatalf("finish registration: %v", err)
+	}
+	if !bytes.Equal(cred.CredentialId, sa.id) || cred.Name != "laptop" || len(s.credentials) != 1 {
+		t.Fatalf("unexpected credential %+v", cred)
+	}
+
+	c, err = a.BeginWebAuthnRegistration(ctx, 1)
+	if err != nil {
+		t.Fatalf("begin second registration: %v", err)
+	}
+	_, err = a.FinishWebAuthnRegistration(ctx, 1, c.SessionToken, "", sa.create(c.Options))
+	if !errors.Is(err, ErrWebAuthnCredentialExists) {
+		t.Fatalf("registering the same credential twice: got %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		c, err = a.BeginWebAuthnLogin(ctx, "user@example.com")
+		if err != nil {
+			t.Fatalf("begin login: %v", err)
+		}
+		allowed := allowedCredentials(t, c.Options)
+		if len(allowed) != 1 || !bytes.Equal(allowed[0].CredentialID, sa.id) {
+			t.Fatalf("unexpected allowed credentials %+v", allowed)
+		}
+		tp, err := a.FinishWebAuthnLogin(ctx, c.SessionToken, sa.get(c.Options))
+		if err != nil {
+			t.Fatalf("finish login: %v", err)
+		}
+		if tp.AccessToken == "" || tp.RefreshToken == "" {
+			t.Fatalf("unexpected token pair %+v", tp)
+		}
+		if s.credentials[0].SignCount != sa.signCount {
+			t.Fatalf("sign count %d, want %d", s.credentials[0].SignCount, sa.signCount)
+		}
+	}
+
+	c, err = a.BeginWebAuthnLogin(ctx, "user@example.com")
+	if err != nil {
+		t.Fatalf("begin login: %v", err)
+	}
+	sa.signCount = 0
+	_, err = a.FinishWebAuthnLogin(ctx, c.SessionToken, sa.get(c.Options))
+	if !errors.Is(err, ErrInvalidWebAuthnResponse) {
+		t.Fatalf("replayed sign count: got %v", err)
+	}
+
+	_, err = a.FinishWebAuthnLogin(ctx, c.SessionToken, sa.get(c.Options))
+	if !errors.Is(err, ErrInvalidWebAuthnSession) {
+		t.Fatalf("reusing a session: got %v", err)
+	}
+}
+
+func TestBeginWebAuthnLoginDoesNotRevealAccounts(t *testing.T) {
+	ctx := context.Background()
+	s := newFakeStorage(&models.User{Id: 1, Email: "user@example.com"})
+	a := newWebAuthnTestAuth(t, s)
+
+	for _, email := range []string{"user@example.com", "unknown@example.com"} {
+		first, err := a.BeginWebAuthnLogin(ctx, email)
+		if err != nil {
+			t.Fatalf("%s: begin login: %v", email, err)
+		}
+		second, err := a.BeginWebAuthnLogin(ctx, email)
+		if err != nil {
+			t.Fatalf("%s: begin login: %v", email, err)
+		}
+		allowed := allowedCredentials(t, first.Options)
+		if len(allowed) != 1 {
+			t.Fatalf("%s: got %d allowed credentials, want 1", email, len(allowed))
+		}
+		if !bytes.Equal(allowed[0].CredentialID, allowedCredentials(t, second.Options)[0].CredentialID) {
+			t.Fatalf("%s: decoy credential changed between logins", email)
+		}
+		sa := newSoftAuthenticator(t)
+		_, err = a.FinishWebAuthnLogin(ctx, first.SessionToken, sa.get(first.Options))
+		if !errors.Is(err, ErrInvalidWebAuthnResponse) {
+			t.Fatalf("%s: finish login: got %v", email, err)
+		}
+	}
+}
+
+func TestWebAuthnLoginRequiresUserVerification(t *testing.T) {
+	ctx := context.Background()
+	s := newFakeStorage(&models.User{Id: 1, Email: "user@example.com"})
+	a := newWebAuthnTestAuth(t, s)
+	sa := newSoftAuthenticator(t)
+
+	c, err := a.BeginWebAuthnRegistration(ctx, 1)
+	if err != nil {
+		t.Fatalf("begin registration: %v", err)
+	}
+	_, err = a.FinishWebAuthnRegistration(ctx, 1, c.SessionToken, "", sa.create(c.Options))
+	if err != nil {
+		t.Fatalf("finish registration: %v", err)
+	}
+
+	c, err = a.BeginWebAuthnLogin(ctx, "user@example.com")
+	if err != nil {
+		t.Fatalf("begin login: %v", err)
+	}
+	var assertion protocol.CredentialAssertion
+	if err := json.Unmarshal(c.Options, &assertion); err != nil {
+		t.Fatal(err)
+	}
+	if assertion.Response.UserVerification != protocol.VerificationRequired {
+		t.Fatalf("user verification %q, want %q", assertion.Response.UserVerification, protocol.VerificationRequired)
+	}
+	sa.skipUV = true
+	_, err = a.FinishWebAuthnLogin(ctx, c.SessionToken, sa.get(c.Options))
+	if !errors.Is(err, ErrInvalidWebAuthnResponse) {
+		t.Fatalf("assertion without user verification: got %v", err)
+	}
+	if s.throttles[userThrottleKey(1)] == nil {
+		t.Fatal("assertion without user verification was not counted as a failed login")
+	}
+}
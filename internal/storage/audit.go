@@ -0,0 +1,25 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/vindosVP/snauth/internal/models"
+)
+
+func (us *UserStorage) SaveAuditEvent(ctx context.Context, e *models.AuditEvent) error {
+	err := us.s.SaveAuditEvent(ctx, e)
+	if err != nil {
+		return errors.Wrap(err, "failed to save audit event")
+	}
+	return nil
+}
+
+func (us *UserStorage) ListAuditEvents(ctx context.Context, filter models.AuditFilter, beforeId int64, limit int) ([]*models.AuditEvent, error) {
+	events, err := us.s.ListAuditEvents(ctx, filter, beforeId, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list audit events")
+	}
+	return events, nil
+}
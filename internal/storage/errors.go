@@ -5,4 +5,27 @@ import "github.com/pkg/errors"
 var (
 	ErrUserAlreadyExists = errors.New("user with this email already exists")
 	ErrUserDoesNotExist  = errors.New("user does not exist")
+	ErrLastAdmin         = errors.New("no active admin would be left")
+
+	ErrSigningKeyPending = errors.New("another signing key is waiting to become active")
+
+	ErrRefreshTokenNotFound    = errors.New("refresh token not found")
+	ErrRefreshTokenAlreadyUsed = errors.New("refresh token already used or revoked")
+	ErrOneTimeTokenInvalid     = errors.New("one-time token is invalid, expired or used")
+
+	ErrRoleAlreadyExists = errors.New("role with this name already exists")
+	ErrRoleDoesNotExist  = errors.New("role does not exist")
+
+	ErrTOTPNotFound        = errors.New("totp not found")
+	ErrTOTPCodeUsed        = errors.New("totp code already used")
+	ErrRecoveryCodeInvalid = errors.New("recovery code is invalid or used")
+
+	ErrWebAuthnCredentialExists   = errors.New("webauthn credential is already registered")
+	ErrWebAuthnCredentialNotFound = errors.New("webauthn credential not found")
+	ErrWebAuthnSessionInvalid     = errors.New("webauthn session is invalid, expired or used")
+
+	ErrOAuthClientDoesNotExist  = errors.New("oauth client does not exist")
+	ErrAuthorizationCodeInvalid = errors.New("authorization code is invalid, expired or used")
+
+	ErrServiceAccountDoesNotExist = errors.New("service account does not exist")
 )
@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+
+	"github.com/vindosVP/snauth/internal/models"
+)
+
+// LoginThrottle returns the failed logins of the key, a zero value if
+// there were none.
+func (us *UserStorage) LoginThrottle(ctx context.Context, key string) (*models.LoginThrottle, error) {
+	t, err := us.s.LoginThrottle(ctx, key)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return &models.LoginThrottle{Key: key}, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get login throttle")
+	}
+	return t, nil
+}
+
+func (us *UserStorage) RecordLoginFailure(ctx context.Context, key string, resetBefore time.Time) (*models.LoginThrottle, error) {
+	t, err := us.s.RecordLoginFailure(ctx, key, resetBefore)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to record login failure")
+	}
+	return t, nil
+}
+
+func (us *UserStorage) LockLogin(ctx context.Context, key string, until time.Time) error {
+	err := us.s.LockLogin(ctx, key, until)
+	if err != nil {
+		return errors.Wrap(err, "failed to lock login")
+	}
+	return nil
+}
+
+func (us *UserStorage) ResetLoginThrottle(ctx context.Context, key string) error {
+	err := us.s.ResetLoginThrottle(ctx, key)
+	if err != nil {
+		return errors.Wrap(err, "failed to reset login throttle")
+	}
+	return nil
+}
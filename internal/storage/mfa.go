@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+
+	"github.com/vindosVP/snauth/internal/models"
+)
+
+func (us *UserStorage) SaveTOTP(ctx context.Context, userId int64, secret []byte) error {
+	err := us.s.SaveTOTP(ctx, userId, secret)
+	if err != nil {
+		return errors.Wrap(err, "failed to save totp")
+	}
+	return nil
+}
+
+func (us *UserStorage) TOTP(ctx context.Context, userId int64) (*models.TOTP, error) {
+	t, err := us.s.TOTP(ctx, userId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrTOTPNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get totp")
+	}
+	return t, nil
+}
+
+// ConfirmTOTP fails with ErrTOTPNotFound if there is no pending enrollment.
+func (us *UserStorage) ConfirmTOTP(ctx context.Context, userId int64, counter int64, recoveryCodeHashes []string) error {
+	err := us.s.ConfirmTOTP(ctx, userId, counter, recoveryCodeHashes)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrTOTPNotFound
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to confirm totp")
+	}
+	return nil
+}
+
+// UseTOTPCounter fails with ErrTOTPCodeUsed if a code of the same or a
+// later period was accepted before.
+func (us *UserStorage) UseTOTPCounter(ctx context.Context, userId int64, counter int64) error {
+	err := us.s.UseTOTPCounter(ctx, userId, counter)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrTOTPCodeUsed
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to use totp code")
+	}
+	return nil
+}
+
+func (us *UserStorage) UseRecoveryCode(ctx context.Context, userId int64, codeHash string) error {
+	err := us.s.UseRecoveryCode(ctx, userId, codeHash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrRecoveryCodeInvalid
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to use recovery code")
+	}
+	return nil
+}
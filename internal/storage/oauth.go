@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+
+	"github.com/vindosVP/snauth/internal/models"
+)
+
+func (us *UserStorage) CreateOAuthClient(ctx context.Context, c *models.OAuthClient) error {
+	err := us.s.CreateOAuthClient(ctx, c)
+	if err != nil {
+		return errors.Wrap(err, "failed to create oauth client")
+	}
+	return nil
+}
+
+func (us *UserStorage) OAuthClient(ctx context.Context, clientId string) (*models.OAuthClient, error) {
+	c, err := us.s.OAuthClient(ctx, clientId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrOAuthClientDoesNotExist
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get oauth client")
+	}
+	return c, nil
+}
+
+func (us *UserStorage) OAuthClients(ctx context.Context) ([]*models.OAuthClient, error) {
+	clients, err := us.s.OAuthClients(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get oauth clients")
+	}
+	return clients, nil
+}
+
+func (us *UserStorage) DeleteOAuthClient(ctx context.Context, clientId string) error {
+	err := us.s.DeleteOAuthClient(ctx, clientId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrOAuthClientDoesNotExist
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to delete oauth client")
+	}
+	return nil
+}
+
+func (us *UserStorage) SaveAuthorizationCode(ctx context.Context, c *models.AuthorizationCode) error {
+	err := us.s.SaveAuthorizationCode(ctx, c)
+	if err != nil {
+		return errors.Wrap(err, "failed to save authorization code")
+	}
+	return nil
+}
+
+// UseAuthorizationCode fails with ErrAuthorizationCodeInvalid if the code
+// does not exist, has expired or was used before.
+func (us *UserStorage) UseAuthorizationCode(ctx context.Context, codeHash string) (*models.AuthorizationCode, error) {
+	c, err := us.s.UseAuthorizationCode(ctx, codeHash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrAuthorizationCodeInvalid
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to use authorization code")
+	}
+	return c, nil
+}
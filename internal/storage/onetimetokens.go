@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+
+	"github.com/vindosVP/snauth/internal/models"
+)
+
+func (us *UserStorage) SaveOneTimeToken(ctx context.Context, t *models.OneTimeToken) error {
+	err := us.s.SaveOneTimeToken(ctx, t)
+	if err != nil {
+		return errors.Wrap(err, "failed to save one-time token")
+	}
+	return nil
+}
+
+// OneTimeToken returns the token without consuming it. It fails with
+// ErrOneTimeTokenInvalid if the token does not exist, has expired or was
+// used before.
+func (us *UserStorage) OneTimeToken(ctx context.Context, purpose string, tokenHash string) (*models.OneTimeToken, error) {
+	t, err := us.s.OneTimeToken(ctx, purpose, tokenHash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrOneTimeTokenInvalid
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get one-time token")
+	}
+	return t, nil
+}
+
+// UseOneTimeToken consumes the token. It fails with ErrOneTimeTokenInvalid
+// if the token does not exist, has expired or was used before.
+func (us *UserStorage) UseOneTimeToken(ctx context.Context, purpose string, tokenHash string) (*models.OneTimeToken, error) {
+	t, err := us.s.UseOneTimeToken(ctx, purpose, tokenHash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrOneTimeTokenInvalid
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to use one-time token")
+	}
+	return t, nil
+}
+
+func (us *UserStorage) InvalidateOneTimeTokens(ctx context.Context, userId int64, purpose string) error {
+	err := us.s.InvalidateOneTimeTokens(ctx, userId, purpose)
+	if err != nil {
+		return errors.Wrap(err, "failed to invalidate one-time tokens")
+	}
+	return nil
+}
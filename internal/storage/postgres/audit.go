@@ -0,0 +1,66 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/vindosVP/snauth/internal/models"
+)
+
+func (s *Storage) SaveAuditEvent(ctx context.Context, e *models.AuditEvent) error {
+	query := `INSERT INTO audit_events (type, actor_id, actor_service_account, target_id, ip, request_id, details, created_at) 
+				VALUES ($1, NULLIF($2, 0), NULLIF($3, ''), NULLIF($4, 0), $5, $6, $7, $8) RETURNING id, created_at`
+	return s.db.QueryRow(ctx, query, e.Type, e.ActorId, e.ActorServiceAccount, e.TargetId, e.IP, e.RequestId, e.Details, time.Now()).
+		Scan(&e.Id, &e.CreatedAt)
+}
+
+// ListAuditEvents returns the newest events matching the filter with an id
+// below beforeId, if it is set.
+func (s *Storage) ListAuditEvents(ctx context.Context, filter models.AuditFilter, beforeId int64, limit int) ([]*models.AuditEvent, error) {
+	var conditions []string
+	var args []any
+	add := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.Type != "" {
+		add("type = $%d", filter.Type)
+	}
+	if filter.ActorId != 0 {
+		add("actor_id = $%d", filter.ActorId)
+	}
+	if filter.ActorServiceAccount != "" {
+		add("actor_service_account = $%d", filter.ActorServiceAccount)
+	}
+	if filter.TargetId != 0 {
+		add("target_id = $%d", filter.TargetId)
+	}
+	if filter.From != nil {
+		add("created_at >= $%d", *filter.From)
+	}
+	if filter.To != nil {
+		add("created_at < $%d", *filter.To)
+	}
+	if beforeId != 0 {
+		add("id < $%d", beforeId)
+	}
+	args = append(args, limit)
+	query := fmt.Sprintf(`SELECT id, type, COALESCE(actor_id, 0), COALESCE(actor_service_account, ''), COALESCE(target_id, 0), ip, request_id, details, created_at 
+				FROM audit_events %s ORDER BY id DESC LIMIT $%d`, where(conditions), len(args))
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	events := make([]*models.AuditEvent, 0, limit)
+	for rows.Next() {
+		e := &models.AuditEvent{}
+		err := rows.Scan(&e.Id, &e.Type, &e.ActorId, &e.ActorServiceAccount, &e.TargetId, &e.IP, &e.RequestId, &e.Details, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
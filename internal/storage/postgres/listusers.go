@@ -0,0 +1,99 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/vindosVP/snauth/internal/models"
+)
+
+func (s *Storage) ListUsers(ctx context.Context, filter models.UserFilter, page models.UserPage) ([]*models.User, error) {
+	conditions, args := userConditions(filter)
+	sortColumn := "id"
+	if page.SortBy == models.UserSortByCreatedAt {
+		sortColumn = "created_at"
+	}
+	direction, cmp := "ASC", ">"
+	if page.Descending {
+		direction, cmp = "DESC", "<"
+	}
+	if page.After != nil {
+		if sortColumn == "id" {
+			args = append(args, page.After.Id)
+			conditions = append(conditions, fmt.Sprintf("id %s $%d", cmp, len(args)))
+		} else {
+			args = append(args, page.After.CreatedAt, page.After.Id)
+			conditions = append(conditions, fmt.Sprintf("(created_at, id) %s ($%d, $%d)", cmp, len(args)-1, len(args)))
+		}
+	}
+	args = append(args, page.Limit)
+	query := fmt.Sprintf(`SELECT %s FROM users %s ORDER BY %s %s, id %s LIMIT $%d`,
+		userColumns, where(conditions), sortColumn, direction, direction, len(args))
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	users := make([]*models.User, 0, page.Limit)
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func (s *Storage) CountUsers(ctx context.Context, filter models.UserFilter) (int64, error) {
+	var count int64
+	conditions, args := userConditions(filter)
+	query := "SELECT COUNT(id) FROM users " + where(conditions)
+	err := s.db.QueryRow(ctx, query, args...).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func userConditions(filter models.UserFilter) ([]string, []any) {
+	var conditions []string
+	var args []any
+	add := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.IsBanned != nil {
+		add("is_banned = $%d", *filter.IsBanned)
+	}
+	if filter.IsDeleted != nil {
+		add("is_deleted = $%d", *filter.IsDeleted)
+	}
+	if filter.IsAdmin != nil {
+		add("is_admin = $%d", *filter.IsAdmin)
+	}
+	if filter.CreatedFrom != nil {
+		add("created_at >= $%d", *filter.CreatedFrom)
+	}
+	if filter.CreatedTo != nil {
+		add("created_at < $%d", *filter.CreatedTo)
+	}
+	if filter.EmailContains != "" {
+		add("email ILIKE '%%' || $%d || '%%'", escapeLike(filter.EmailContains))
+	}
+	return conditions, args
+}
+
+func where(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(conditions, " AND ")
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
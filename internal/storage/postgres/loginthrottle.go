@@ -0,0 +1,48 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/vindosVP/snauth/internal/models"
+)
+
+func (s *Storage) LoginThrottle(ctx context.Context, key string) (*models.LoginThrottle, error) {
+	t := &models.LoginThrottle{}
+	query := `SELECT key, failures, last_failure_at, locked_until FROM login_throttle WHERE key = $1`
+	err := s.db.QueryRow(ctx, query, key).Scan(&t.Key, &t.Failures, &t.LastFailureAt, &t.LockedUntil)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// RecordLoginFailure increments the failure counter of the key. Counting
+// starts over if the previous failure and the lockout ended before
+// resetBefore.
+func (s *Storage) RecordLoginFailure(ctx context.Context, key string, resetBefore time.Time) (*models.LoginThrottle, error) {
+	t := &models.LoginThrottle{}
+	query := `INSERT INTO login_throttle (key, failures, last_failure_at) VALUES ($1, 1, $2) 
+				ON CONFLICT (key) DO UPDATE SET 
+					failures = CASE WHEN GREATEST(login_throttle.last_failure_at, login_throttle.locked_until) < $3 THEN 1 ELSE login_throttle.failures + 1 END,
+					last_failure_at = $2
+				RETURNING key, failures, last_failure_at, locked_until`
+	row := s.db.QueryRow(ctx, query, key, time.Now(), resetBefore)
+	err := row.Scan(&t.Key, &t.Failures, &t.LastFailureAt, &t.LockedUntil)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (s *Storage) LockLogin(ctx context.Context, key string, until time.Time) error {
+	query := `UPDATE login_throttle SET locked_until = $1 WHERE key = $2`
+	_, err := s.db.Exec(ctx, query, until, key)
+	return err
+}
+
+func (s *Storage) ResetLoginThrottle(ctx context.Context, key string) error {
+	query := `DELETE FROM login_throttle WHERE key = $1`
+	_, err := s.db.Exec(ctx, query, key)
+	return err
+}
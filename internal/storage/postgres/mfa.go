@@ -0,0 +1,74 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/vindosVP/snauth/internal/models"
+)
+
+// SaveTOTP starts a new enrollment, replacing a pending one. Confirmed
+// enrollments are left untouched.
+func (s *Storage) SaveTOTP(ctx context.Context, userId int64, secret []byte) error {
+	query := `INSERT INTO user_totp (user_id, secret, last_counter, created_at) VALUES ($1, $2, 0, $3) 
+				ON CONFLICT (user_id) DO UPDATE SET 
+					secret = EXCLUDED.secret, last_counter = 0, created_at = EXCLUDED.created_at
+				WHERE user_totp.confirmed_at IS NULL`
+	_, err := s.db.Exec(ctx, query, userId, secret, time.Now())
+	return err
+}
+
+func (s *Storage) TOTP(ctx context.Context, userId int64) (*models.TOTP, error) {
+	t := &models.TOTP{}
+	query := `SELECT user_id, secret, last_counter, created_at, confirmed_at FROM user_totp WHERE user_id = $1`
+	err := s.db.QueryRow(ctx, query, userId).Scan(&t.UserId, &t.Secret, &t.LastCounter, &t.CreatedAt, &t.ConfirmedAt)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// ConfirmTOTP completes the enrollment and replaces the recovery codes.
+func (s *Storage) ConfirmTOTP(ctx context.Context, userId int64, counter int64, recoveryCodeHashes []string) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	now := time.Now()
+	var id int64
+	query := `UPDATE user_totp SET confirmed_at = $1, last_counter = $2 
+				WHERE user_id = $3 AND confirmed_at IS NULL RETURNING user_id`
+	err = tx.QueryRow(ctx, query, now, counter, userId).Scan(&id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userId)
+	if err != nil {
+		return err
+	}
+	for _, h := range recoveryCodeHashes {
+		query := `INSERT INTO recovery_codes (user_id, code_hash, created_at) VALUES ($1, $2, $3)`
+		_, err = tx.Exec(ctx, query, userId, h, now)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// UseTOTPCounter records the period of an accepted code. Only periods
+// after the last accepted one can be used.
+func (s *Storage) UseTOTPCounter(ctx context.Context, userId int64, counter int64) error {
+	var id int64
+	query := `UPDATE user_totp SET last_counter = $1 
+				WHERE user_id = $2 AND last_counter < $1 AND confirmed_at IS NOT NULL RETURNING user_id`
+	return s.db.QueryRow(ctx, query, counter, userId).Scan(&id)
+}
+
+func (s *Storage) UseRecoveryCode(ctx context.Context, userId int64, codeHash string) error {
+	var id int64
+	query := `UPDATE recovery_codes SET used_at = $1 
+				WHERE user_id = $2 AND code_hash = $3 AND used_at IS NULL RETURNING id`
+	return s.db.QueryRow(ctx, query, time.Now(), userId, codeHash).Scan(&id)
+}
@@ -0,0 +1,80 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/vindosVP/snauth/internal/models"
+)
+
+const oauthClientQuery = `SELECT id, client_id, name, secret_hash, redirect_uris, created_at FROM oauth_clients`
+
+func (s *Storage) CreateOAuthClient(ctx context.Context, c *models.OAuthClient) error {
+	query := `INSERT INTO oauth_clients (client_id, name, secret_hash, redirect_uris, created_at) 
+				VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at`
+	return s.db.QueryRow(ctx, query, c.ClientId, c.Name, c.SecretHash, c.RedirectURIs, time.Now()).
+		Scan(&c.Id, &c.CreatedAt)
+}
+
+func (s *Storage) OAuthClient(ctx context.Context, clientId string) (*models.OAuthClient, error) {
+	query := oauthClientQuery + ` WHERE client_id = $1`
+	return scanOAuthClient(s.db.QueryRow(ctx, query, clientId))
+}
+
+func (s *Storage) OAuthClients(ctx context.Context) ([]*models.OAuthClient, error) {
+	query := oauthClientQuery + ` ORDER BY id`
+	rows, err := s.db.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	clients := make([]*models.OAuthClient, 0)
+	for rows.Next() {
+		c, err := scanOAuthClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, c)
+	}
+	return clients, rows.Err()
+}
+
+func (s *Storage) DeleteOAuthClient(ctx context.Context, clientId string) error {
+	var id int64
+	query := `DELETE FROM oauth_clients WHERE client_id = $1 RETURNING id`
+	return s.db.QueryRow(ctx, query, clientId).Scan(&id)
+}
+
+func (s *Storage) SaveAuthorizationCode(ctx context.Context, c *models.AuthorizationCode) error {
+	query := `INSERT INTO authorization_codes (code_hash, client_id, user_id, redirect_uri, scope, nonce, code_challenge, 
+				auth_time, created_at, expires_at) 
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id, created_at`
+	return s.db.QueryRow(ctx, query, c.CodeHash, c.ClientId, c.UserId, c.RedirectURI, c.Scope, c.Nonce, c.CodeChallenge,
+		c.AuthTime, time.Now(), c.ExpiresAt).Scan(&c.Id, &c.CreatedAt)
+}
+
+func (s *Storage) UseAuthorizationCode(ctx context.Context, codeHash string) (*models.AuthorizationCode, error) {
+	c := &models.AuthorizationCode{}
+	now := time.Now()
+	query := `UPDATE authorization_codes SET used_at = $1 
+				WHERE code_hash = $2 AND used_at IS NULL AND expires_at > $1 
+				RETURNING id, code_hash, client_id, user_id, redirect_uri, scope, nonce, code_challenge, 
+					auth_time, created_at, expires_at, used_at`
+	err := s.db.QueryRow(ctx, query, now, codeHash).Scan(&c.Id, &c.CodeHash, &c.ClientId, &c.UserId, &c.RedirectURI,
+		&c.Scope, &c.Nonce, &c.CodeChallenge, &c.AuthTime, &c.CreatedAt, &c.ExpiresAt, &c.UsedAt)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func scanOAuthClient(row pgx.Row) (*models.OAuthClient, error) {
+	c := &models.OAuthClient{}
+	err := row.Scan(&c.Id, &c.ClientId, &c.Name, &c.SecretHash, &c.RedirectURIs, &c.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,47 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/vindosVP/snauth/internal/models"
+)
+
+func (s *Storage) SaveOneTimeToken(ctx context.Context, t *models.OneTimeToken) error {
+	query := `INSERT INTO one_time_tokens (user_id, purpose, token_hash, created_at, expires_at) 
+				VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at`
+	return s.db.QueryRow(ctx, query, t.UserId, t.Purpose, t.TokenHash, time.Now(), t.ExpiresAt).
+		Scan(&t.Id, &t.CreatedAt)
+}
+
+func (s *Storage) OneTimeToken(ctx context.Context, purpose string, tokenHash string) (*models.OneTimeToken, error) {
+	t := &models.OneTimeToken{}
+	query := `SELECT id, user_id, purpose, token_hash, created_at, expires_at, used_at FROM one_time_tokens 
+				WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > $3`
+	row := s.db.QueryRow(ctx, query, tokenHash, purpose, time.Now())
+	err := row.Scan(&t.Id, &t.UserId, &t.Purpose, &t.TokenHash, &t.CreatedAt, &t.ExpiresAt, &t.UsedAt)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (s *Storage) UseOneTimeToken(ctx context.Context, purpose string, tokenHash string) (*models.OneTimeToken, error) {
+	t := &models.OneTimeToken{}
+	now := time.Now()
+	query := `UPDATE one_time_tokens SET used_at = $1 
+				WHERE token_hash = $2 AND purpose = $3 AND used_at IS NULL AND expires_at > $1 
+				RETURNING id, user_id, purpose, token_hash, created_at, expires_at, used_at`
+	row := s.db.QueryRow(ctx, query, now, tokenHash, purpose)
+	err := row.Scan(&t.Id, &t.UserId, &t.Purpose, &t.TokenHash, &t.CreatedAt, &t.ExpiresAt, &t.UsedAt)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (s *Storage) InvalidateOneTimeTokens(ctx context.Context, userId int64, purpose string) error {
+	query := `UPDATE one_time_tokens SET used_at = $1 WHERE user_id = $2 AND purpose = $3 AND used_at IS NULL`
+	_, err := s.db.Exec(ctx, query, time.Now(), userId, purpose)
+	return err
+}
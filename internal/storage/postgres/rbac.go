@@ -0,0 +1,113 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/vindosVP/snauth/internal/models"
+)
+
+const roleQuery = `SELECT r.id, r.name, r.created_at, 
+				COALESCE(array_agg(p.permission ORDER BY p.permission) FILTER (WHERE p.permission IS NOT NULL), '{}') 
+				FROM roles r LEFT JOIN role_permissions p ON p.role_id = r.id`
+
+func scanRole(row pgx.Row) (*models.Role, error) {
+	r := &models.Role{}
+	err := row.Scan(&r.Id, &r.Name, &r.CreatedAt, &r.Permissions)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// CreateRole creates the role together with its permissions, so a failed
+// grant leaves no role behind.
+func (s *Storage) CreateRole(ctx context.Context, name string, permissions []string) (*models.Role, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+	var id int64
+	query := `INSERT INTO roles (name, created_at) VALUES ($1, $2) RETURNING id`
+	err = tx.QueryRow(ctx, query, name, time.Now()).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range permissions {
+		query := `INSERT INTO role_permissions (role_id, permission) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+		_, err = tx.Exec(ctx, query, id, p)
+		if err != nil {
+			return nil, err
+		}
+	}
+	r, err := scanRole(tx.QueryRow(ctx, roleQuery+` WHERE r.id = $1 GROUP BY r.id`, id))
+	if err != nil {
+		return nil, err
+	}
+	return r, tx.Commit(ctx)
+}
+
+func (s *Storage) RoleByName(ctx context.Context, name string) (*models.Role, error) {
+	query := roleQuery + ` WHERE r.name = $1 GROUP BY r.id`
+	return scanRole(s.db.QueryRow(ctx, query, name))
+}
+
+func (s *Storage) Roles(ctx context.Context) ([]*models.Role, error) {
+	query := roleQuery + ` GROUP BY r.id ORDER BY r.name`
+	rows, err := s.db.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	roles := make([]*models.Role, 0)
+	for rows.Next() {
+		r, err := scanRole(rows)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, r)
+	}
+	return roles, rows.Err()
+}
+
+func (s *Storage) GrantPermission(ctx context.Context, roleId int64, permission string) error {
+	query := `INSERT INTO role_permissions (role_id, permission) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+	_, err := s.db.Exec(ctx, query, roleId, permission)
+	return err
+}
+
+func (s *Storage) RevokePermission(ctx context.Context, roleId int64, permission string) error {
+	query := `DELETE FROM role_permissions WHERE role_id = $1 AND permission = $2`
+	_, err := s.db.Exec(ctx, query, roleId, permission)
+	return err
+}
+
+func (s *Storage) AssignRole(ctx context.Context, userId int64, roleId int64) error {
+	query := `INSERT INTO user_roles (user_id, role_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+	_, err := s.db.Exec(ctx, query, userId, roleId)
+	return err
+}
+
+func (s *Storage) UnassignRole(ctx context.Context, userId int64, roleId int64) error {
+	query := `DELETE FROM user_roles WHERE user_id = $1 AND role_id = $2`
+	_, err := s.db.Exec(ctx, query, userId, roleId)
+	return err
+}
+
+func (s *Storage) UserAccess(ctx context.Context, userId int64) (*models.UserAccess, error) {
+	a := &models.UserAccess{}
+	query := `SELECT COALESCE(array_agg(DISTINCT r.name), '{}'), 
+				COALESCE(array_agg(DISTINCT p.permission) FILTER (WHERE p.permission IS NOT NULL), '{}') 
+				FROM user_roles ur 
+				JOIN roles r ON r.id = ur.role_id 
+				LEFT JOIN role_permissions p ON p.role_id = ur.role_id 
+				WHERE ur.user_id = $1`
+	err := s.db.QueryRow(ctx, query, userId).Scan(&a.Roles, &a.Permissions)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
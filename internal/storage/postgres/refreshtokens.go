@@ -0,0 +1,57 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/vindosVP/snauth/internal/models"
+)
+
+func (s *Storage) SaveRefreshToken(ctx context.Context, t *models.RefreshToken) error {
+	query := `INSERT INTO refresh_tokens (user_id, family_id, client_id, scope, token_hash, auth_time, created_at, expires_at) 
+				VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7, $8) RETURNING id, created_at`
+	return s.db.QueryRow(ctx, query, t.UserId, t.FamilyId, t.ClientId, t.Scope, t.TokenHash, t.AuthTime, time.Now(), t.ExpiresAt).
+		Scan(&t.Id, &t.CreatedAt)
+}
+
+func (s *Storage) RefreshTokenByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	t := &models.RefreshToken{}
+	query := `SELECT id, user_id, family_id, COALESCE(client_id, ''), scope, token_hash, COALESCE(auth_time, created_at), 
+				created_at, expires_at, used_at, revoked_at 
+				FROM refresh_tokens WHERE token_hash = $1`
+	row := s.db.QueryRow(ctx, query, tokenHash)
+	err := row.Scan(&t.Id, &t.UserId, &t.FamilyId, &t.ClientId, &t.Scope, &t.TokenHash, &t.AuthTime,
+		&t.CreatedAt, &t.ExpiresAt, &t.UsedAt, &t.RevokedAt)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (s *Storage) UseRefreshToken(ctx context.Context, id int64) error {
+	var usedId int64
+	query := `UPDATE refresh_tokens SET used_at = $1 
+				WHERE id = $2 AND used_at IS NULL AND revoked_at IS NULL RETURNING id`
+	return s.db.QueryRow(ctx, query, time.Now(), id).Scan(&usedId)
+}
+
+func (s *Storage) RevokeRefreshTokenFamily(ctx context.Context, familyId string) error {
+	query := `UPDATE refresh_tokens SET revoked_at = $1 WHERE family_id = $2 AND revoked_at IS NULL`
+	_, err := s.db.Exec(ctx, query, time.Now(), familyId)
+	return err
+}
+
+func (s *Storage) RevokeUserRefreshTokens(ctx context.Context, userId int64) error {
+	query := `UPDATE refresh_tokens SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL`
+	_, err := s.db.Exec(ctx, query, time.Now(), userId)
+	return err
+}
+
+// RefreshTokenFamilyActive reports whether the family has refresh tokens
+// that were not revoked.
+func (s *Storage) RefreshTokenFamilyActive(ctx context.Context, familyId string) (bool, error) {
+	var active bool
+	query := `SELECT EXISTS (SELECT 1 FROM refresh_tokens WHERE family_id = $1 AND revoked_at IS NULL)`
+	err := s.db.QueryRow(ctx, query, familyId).Scan(&active)
+	return active, err
+}
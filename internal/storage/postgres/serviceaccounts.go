@@ -0,0 +1,64 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/vindosVP/snauth/internal/models"
+)
+
+const serviceAccountQuery = `SELECT id, client_id, name, secret_hash, scopes, created_at, secret_rotated_at, disabled_at 
+				FROM service_accounts`
+
+func (s *Storage) CreateServiceAccount(ctx context.Context, a *models.ServiceAccount) error {
+	query := `INSERT INTO service_accounts (client_id, name, secret_hash, scopes, created_at) 
+				VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at`
+	return s.db.QueryRow(ctx, query, a.ClientId, a.Name, a.SecretHash, a.Scopes, time.Now()).
+		Scan(&a.Id, &a.CreatedAt)
+}
+
+func (s *Storage) ServiceAccount(ctx context.Context, clientId string) (*models.ServiceAccount, error) {
+	query := serviceAccountQuery + ` WHERE client_id = $1`
+	return scanServiceAccount(s.db.QueryRow(ctx, query, clientId))
+}
+
+func (s *Storage) ServiceAccounts(ctx context.Context) ([]*models.ServiceAccount, error) {
+	query := serviceAccountQuery + ` ORDER BY id`
+	rows, err := s.db.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	accounts := make([]*models.ServiceAccount, 0)
+	for rows.Next() {
+		a, err := scanServiceAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, a)
+	}
+	return accounts, rows.Err()
+}
+
+func (s *Storage) RotateServiceAccountSecret(ctx context.Context, clientId string, secretHash string, rotatedAt time.Time) error {
+	var id int64
+	query := `UPDATE service_accounts SET secret_hash = $1, secret_rotated_at = $2 WHERE client_id = $3 RETURNING id`
+	return s.db.QueryRow(ctx, query, secretHash, rotatedAt, clientId).Scan(&id)
+}
+
+func (s *Storage) DisableServiceAccount(ctx context.Context, clientId string, disabledAt time.Time) error {
+	var id int64
+	query := `UPDATE service_accounts SET disabled_at = COALESCE(disabled_at, $1) WHERE client_id = $2 RETURNING id`
+	return s.db.QueryRow(ctx, query, disabledAt, clientId).Scan(&id)
+}
+
+func scanServiceAccount(row pgx.Row) (*models.ServiceAccount, error) {
+	a := &models.ServiceAccount{}
+	err := row.Scan(&a.Id, &a.ClientId, &a.Name, &a.SecretHash, &a.Scopes, &a.CreatedAt, &a.SecretRotatedAt, &a.DisabledAt)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
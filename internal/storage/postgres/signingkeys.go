@@ -0,0 +1,65 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/vindosVP/snauth/internal/models"
+	"github.com/vindosVP/snauth/internal/storage"
+)
+
+// SaveSigningKey stores k as the key that becomes active at
+// k.ActivatesAt, the active key is retired at that time. It fails with
+// storage.ErrSigningKeyPending while another key is waiting to become
+// active. The table is locked, so concurrent rotations run one by one.
+func (s *Storage) SaveSigningKey(ctx context.Context, k *models.SigningKey) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	_, err = tx.Exec(ctx, `LOCK TABLE signing_keys IN EXCLUSIVE MODE`)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	var pending bool
+	err = tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM signing_keys WHERE activates_at > $1)`, now).Scan(&pending)
+	if err != nil {
+		return err
+	}
+	if pending {
+		return storage.ErrSigningKeyPending
+	}
+	_, err = tx.Exec(ctx, `UPDATE signing_keys SET retired_at = $1 WHERE retired_at IS NULL`, k.ActivatesAt)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO signing_keys (kid, algorithm, private_key, created_at, activates_at) 
+				VALUES ($1, $2, $3, $4, $5) RETURNING created_at`
+	err = tx.QueryRow(ctx, query, k.Id, k.Algorithm, k.PrivateKey, now, k.ActivatesAt).Scan(&k.CreatedAt)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// SigningKeys returns the stored keys, oldest first.
+func (s *Storage) SigningKeys(ctx context.Context) ([]*models.SigningKey, error) {
+	query := `SELECT kid, algorithm, private_key, created_at, activates_at, retired_at FROM signing_keys ORDER BY created_at`
+	rows, err := s.db.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	keys := make([]*models.SigningKey, 0)
+	for rows.Next() {
+		k := &models.SigningKey{}
+		err := rows.Scan(&k.Id, &k.Algorithm, &k.PrivateKey, &k.CreatedAt, &k.ActivatesAt, &k.RetiredAt)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
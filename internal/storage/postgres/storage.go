@@ -2,11 +2,14 @@ package postgres
 
 import (
 	"context"
+	"fmt"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 
 	"github.com/vindosVP/snauth/internal/models"
+	"github.com/vindosVP/snauth/internal/storage"
 )
 
 type Storage struct {
@@ -18,33 +21,83 @@ func New(db *pgxpool.Pool) *Storage {
 }
 
 func (s *Storage) SetDeletedToUser(ctx context.Context, userId int64, isDeleted bool) (bool, error) {
-	var deleted bool
-	query := `UPDATE users SET is_deleted = $1 WHERE id = $2 RETURNING is_deleted`
-	err := s.db.QueryRow(ctx, query, isDeleted, userId).Scan(&deleted)
-	if err != nil {
-		return false, err
-	}
-	return deleted, nil
+	return s.setUserFlag(ctx, userId, "is_deleted", isDeleted)
 }
 
 func (s *Storage) SetBannedToUser(ctx context.Context, userId int64, isBanned bool) (bool, error) {
-	var banned bool
-	query := `UPDATE users SET is_banned = $1 WHERE id = $2 RETURNING is_banned`
-	err := s.db.QueryRow(ctx, query, isBanned, userId).Scan(&banned)
+	return s.setUserFlag(ctx, userId, "is_banned", isBanned)
+}
+
+func (s *Storage) SetAdminToUser(ctx context.Context, userId int64, isAdmin bool) (bool, error) {
+	return s.setUserFlag(ctx, userId, "is_admin", isAdmin)
+}
+
+// activeAdmins matches admins able to log in.
+const activeAdmins = `is_admin AND NOT is_banned AND NOT is_deleted`
+
+// setUserFlag updates the flag column and fails with storage.ErrLastAdmin
+// if it would remove the last active admin. The active admins are locked first,
+// so concurrent changes can not each remove a different last admin.
+func (s *Storage) setUserFlag(ctx context.Context, userId int64, column string, value bool) (bool, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+	locked, err := tx.Exec(ctx, `SELECT id FROM users WHERE `+activeAdmins+` FOR UPDATE`)
+	if err != nil {
+		return false, err
+	}
+	var result bool
+	query := fmt.Sprintf(`UPDATE users SET %[1]s = $1 WHERE id = $2 RETURNING %[1]s`, column)
+	err = tx.QueryRow(ctx, query, value, userId).Scan(&result)
 	if err != nil {
 		return false, err
 	}
-	return banned, nil
+	var admins int64
+	err = tx.QueryRow(ctx, `SELECT COUNT(id) FROM users WHERE `+activeAdmins).Scan(&admins)
+	if err != nil {
+		return false, err
+	}
+	if admins == 0 && locked.RowsAffected() > 0 {
+		return false, storage.ErrLastAdmin
+	}
+	return result, tx.Commit(ctx)
 }
 
-func (s *Storage) SetAdminToUser(ctx context.Context, userId int64, isAdmin bool) (bool, error) {
-	var admin bool
-	query := `UPDATE users SET is_admin = $1 WHERE id = $2 RETURNING is_admin`
-	err := s.db.QueryRow(ctx, query, isAdmin, userId).Scan(&admin)
+func (s *Storage) SetTokensValidAfter(ctx context.Context, userId int64, validAfter time.Time) error {
+	var id int64
+	query := `UPDATE users SET tokens_valid_after = $1 WHERE id = $2 RETURNING id`
+	return s.db.QueryRow(ctx, query, validAfter, userId).Scan(&id)
+}
+
+func (s *Storage) UpdatePassword(ctx context.Context, userId int64, hPassword []byte) error {
+	var id int64
+	query := `UPDATE users SET hashed_password = $1 WHERE id = $2 RETURNING id`
+	return s.db.QueryRow(ctx, query, hPassword, userId).Scan(&id)
+}
+
+// ClaimAccount marks the email of the user verified, replaces the password
+// and removes every second factor.
+func (s *Storage) ClaimAccount(ctx context.Context, userId int64, hPassword []byte, verifiedAt time.Time) error {
+	tx, err := s.db.Begin(ctx)
 	if err != nil {
-		return false, err
+		return err
 	}
-	return admin, nil
+	defer tx.Rollback(ctx)
+	var id int64
+	query := `UPDATE users SET hashed_password = $1, email_verified_at = $2 WHERE id = $3 RETURNING id`
+	err = tx.QueryRow(ctx, query, hPassword, verifiedAt, userId).Scan(&id)
+	if err != nil {
+		return err
+	}
+	for _, table := range []string{"user_totp", "recovery_codes", "webauthn_credentials"} {
+		_, err = tx.Exec(ctx, `DELETE FROM `+table+` WHERE user_id = $1`, userId)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
 }
 
 func (s *Storage) CreateUser(ctx context.Context, email string, hPassword []byte) (int64, error) {
@@ -69,26 +122,31 @@ func (s *Storage) CreateUser(ctx context.Context, email string, hPassword []byte
 	return id, nil
 }
 
-func (s *Storage) UserByEmail(ctx context.Context, email string) (*models.User, error) {
+const userColumns = `id, email, hashed_password, created_at, is_banned, is_deleted, is_admin, 
+				tokens_valid_after, email_verified_at`
+
+func scanUser(row pgx.Row) (*models.User, error) {
 	u := &models.User{}
-	query := `SELECT id, email, hashed_password, created_at, is_banned, is_deleted, is_admin 
-				FROM users WHERE email = $1`
-	row := s.db.QueryRow(ctx, query, email)
-	err := row.Scan(&u.Id, &u.Email, &u.HPassword, &u.CreatedAt, &u.IsBanned, &u.IsDeleted, &u.IsAdmin)
+	err := row.Scan(&u.Id, &u.Email, &u.HPassword, &u.CreatedAt, &u.IsBanned, &u.IsDeleted, &u.IsAdmin,
+		&u.TokensValidAfter, &u.EmailVerifiedAt)
 	if err != nil {
 		return nil, err
 	}
 	return u, nil
 }
 
+func (s *Storage) UserByEmail(ctx context.Context, email string) (*models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE email = $1`
+	return scanUser(s.db.QueryRow(ctx, query, email))
+}
+
 func (s *Storage) UserByID(ctx context.Context, id int64) (*models.User, error) {
-	u := &models.User{}
-	query := `SELECT id, email, hashed_password, created_at, is_banned, is_deleted, is_admin 
-				FROM users WHERE id = $1`
-	row := s.db.QueryRow(ctx, query, id)
-	err := row.Scan(&u.Id, &u.Email, &u.HPassword, &u.CreatedAt, &u.IsBanned, &u.IsDeleted, &u.IsAdmin)
-	if err != nil {
-		return nil, err
-	}
-	return u, nil
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
+	return scanUser(s.db.QueryRow(ctx, query, id))
+}
+
+func (s *Storage) SetEmailVerified(ctx context.Context, userId int64, verifiedAt time.Time) error {
+	var id int64
+	query := `UPDATE users SET email_verified_at = $1 WHERE id = $2 RETURNING id`
+	return s.db.QueryRow(ctx, query, verifiedAt, userId).Scan(&id)
 }
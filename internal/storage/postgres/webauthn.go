@@ -0,0 +1,100 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/vindosVP/snauth/internal/models"
+)
+
+const webAuthnCredentialQuery = `SELECT id, user_id, credential_id, name, public_key, attestation_type, transports, 
+				aaguid, sign_count, backup_eligible, backup_state, created_at, last_used_at FROM webauthn_credentials`
+
+func (s *Storage) SaveWebAuthnCredential(ctx context.Context, c *models.WebAuthnCredential) error {
+	query := `INSERT INTO webauthn_credentials (user_id, credential_id, name, public_key, attestation_type, transports, 
+				aaguid, sign_count, backup_eligible, backup_state, created_at) 
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING id, created_at`
+	return s.db.QueryRow(ctx, query, c.UserId, c.CredentialId, c.Name, c.PublicKey, c.AttestationType, c.Transports,
+		c.AAGUID, int64(c.SignCount), c.BackupEligible, c.BackupState, time.Now()).Scan(&c.Id, &c.CreatedAt)
+}
+
+func (s *Storage) WebAuthnCredential(ctx context.Context, credentialId []byte) (*models.WebAuthnCredential, error) {
+	query := webAuthnCredentialQuery + ` WHERE credential_id = $1`
+	return scanWebAuthnCredential(s.db.QueryRow(ctx, query, credentialId))
+}
+
+func (s *Storage) WebAuthnCredentials(ctx context.Context, userId int64) ([]*models.WebAuthnCredential, error) {
+	query := webAuthnCredentialQuery + ` WHERE user_id = $1 ORDER BY id`
+	rows, err := s.db.Query(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	credentials := make([]*models.WebAuthnCredential, 0)
+	for rows.Next() {
+		c, err := scanWebAuthnCredential(rows)
+		if err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, c)
+	}
+	return credentials, rows.Err()
+}
+
+// UpdateWebAuthnCredentialUse stores the state an assertion reported.
+func (s *Storage) UpdateWebAuthnCredentialUse(ctx context.Context, credentialId []byte, signCount uint32, backupState bool) error {
+	var id int64
+	query := `UPDATE webauthn_credentials SET sign_count = $1, backup_state = $2, last_used_at = $3 
+				WHERE credential_id = $4 RETURNING id`
+	return s.db.QueryRow(ctx, query, int64(signCount), backupState, time.Now(), credentialId).Scan(&id)
+}
+
+func (s *Storage) SaveWebAuthnSession(ctx context.Context, ws *models.WebAuthnSession) error {
+	query := `INSERT INTO webauthn_sessions (user_id, ceremony, token_hash, data, expires_at) VALUES (NULLIF($1, 0), $2, $3, $4, $5)`
+	_, err := s.db.Exec(ctx, query, ws.UserId, ws.Ceremony, ws.TokenHash, ws.Data, ws.ExpiresAt)
+	return err
+}
+
+// UseWebAuthnSession deletes the session, so every challenge is answered
+// at most once. Expired sessions are cleaned up with it.
+func (s *Storage) UseWebAuthnSession(ctx context.Context, ceremony string, tokenHash string) (*models.WebAuthnSession, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+	ws := &models.WebAuthnSession{}
+	now := time.Now()
+	query := `DELETE FROM webauthn_sessions WHERE token_hash = $1 AND ceremony = $2 
+				RETURNING COALESCE(user_id, 0), ceremony, token_hash, data, expires_at`
+	err = tx.QueryRow(ctx, query, tokenHash, ceremony).Scan(&ws.UserId, &ws.Ceremony, &ws.TokenHash, &ws.Data, &ws.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(ctx, `DELETE FROM webauthn_sessions WHERE expires_at <= $1`, now)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !ws.ExpiresAt.After(now) {
+		return nil, pgx.ErrNoRows
+	}
+	return ws, nil
+}
+
+func scanWebAuthnCredential(row pgx.Row) (*models.WebAuthnCredential, error) {
+	c := &models.WebAuthnCredential{}
+	var signCount int64
+	err := row.Scan(&c.Id, &c.UserId, &c.CredentialId, &c.Name, &c.PublicKey, &c.AttestationType, &c.Transports,
+		&c.AAGUID, &signCount, &c.BackupEligible, &c.BackupState, &c.CreatedAt, &c.LastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+	c.SignCount = uint32(signCount)
+	return c, nil
+}
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+
+	"github.com/vindosVP/snauth/internal/models"
+)
+
+func (us *UserStorage) CreateRole(ctx context.Context, name string, permissions []string) (*models.Role, error) {
+	r, err := us.s.RoleByName(ctx, name)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+	if r != nil {
+		return nil, ErrRoleAlreadyExists
+	}
+	r, err = us.s.CreateRole(ctx, name, permissions)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to save role")
+	}
+	return r, nil
+}
+
+func (us *UserStorage) RoleByName(ctx context.Context, name string) (*models.Role, error) {
+	r, err := us.s.RoleByName(ctx, name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrRoleDoesNotExist
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get role by name")
+	}
+	return r, nil
+}
+
+func (us *UserStorage) Roles(ctx context.Context) ([]*models.Role, error) {
+	roles, err := us.s.Roles(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get roles")
+	}
+	return roles, nil
+}
+
+func (us *UserStorage) GrantPermission(ctx context.Context, roleId int64, permission string) error {
+	err := us.s.GrantPermission(ctx, roleId, permission)
+	if err != nil {
+		return errors.Wrap(err, "failed to grant permission")
+	}
+	return nil
+}
+
+func (us *UserStorage) RevokePermission(ctx context.Context, roleId int64, permission string) error {
+	err := us.s.RevokePermission(ctx, roleId, permission)
+	if err != nil {
+		return errors.Wrap(err, "failed to revoke permission")
+	}
+	return nil
+}
+
+func (us *UserStorage) AssignRole(ctx context.Context, userId int64, roleId int64) error {
+	err := us.s.AssignRole(ctx, userId, roleId)
+	if err != nil {
+		return errors.Wrap(err, "failed to assign role")
+	}
+	return nil
+}
+
+func (us *UserStorage) UnassignRole(ctx context.Context, userId int64, roleId int64) error {
+	err := us.s.UnassignRole(ctx, userId, roleId)
+	if err != nil {
+		return errors.Wrap(err, "failed to unassign role")
+	}
+	return nil
+}
+
+func (us *UserStorage) UserAccess(ctx context.Context, userId int64) (*models.UserAccess, error) {
+	a, err := us.s.UserAccess(ctx, userId)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get user access")
+	}
+	return a, nil
+}
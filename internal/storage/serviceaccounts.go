@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+
+	"github.com/vindosVP/snauth/internal/models"
+)
+
+func (us *UserStorage) CreateServiceAccount(ctx context.Context, a *models.ServiceAccount) error {
+	err := us.s.CreateServiceAccount(ctx, a)
+	if err != nil {
+		return errors.Wrap(err, "failed to create service account")
+	}
+	return nil
+}
+
+func (us *UserStorage) ServiceAccount(ctx context.Context, clientId string) (*models.ServiceAccount, error) {
+	a, err := us.s.ServiceAccount(ctx, clientId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrServiceAccountDoesNotExist
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get service account")
+	}
+	return a, nil
+}
+
+func (us *UserStorage) ServiceAccounts(ctx context.Context) ([]*models.ServiceAccount, error) {
+	accounts, err := us.s.ServiceAccounts(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get service accounts")
+	}
+	return accounts, nil
+}
+
+func (us *UserStorage) RotateServiceAccountSecret(ctx context.Context, clientId string, secretHash string, rotatedAt time.Time) error {
+	err := us.s.RotateServiceAccountSecret(ctx, clientId, secretHash, rotatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrServiceAccountDoesNotExist
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to rotate service account secret")
+	}
+	return nil
+}
+
+func (us *UserStorage) DisableServiceAccount(ctx context.Context, clientId string, disabledAt time.Time) error {
+	err := us.s.DisableServiceAccount(ctx, clientId, disabledAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrServiceAccountDoesNotExist
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to disable service account")
+	}
+	return nil
+}
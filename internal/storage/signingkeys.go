@@ -0,0 +1,28 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/vindosVP/snauth/internal/models"
+)
+
+func (us *UserStorage) SaveSigningKey(ctx context.Context, k *models.SigningKey) error {
+	err := us.s.SaveSigningKey(ctx, k)
+	if errors.Is(err, ErrSigningKeyPending) {
+		return ErrSigningKeyPending
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to save signing key")
+	}
+	return nil
+}
+
+func (us *UserStorage) SigningKeys(ctx context.Context) ([]*models.SigningKey, error) {
+	keys, err := us.s.SigningKeys(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get signing keys")
+	}
+	return keys, nil
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+
+	"github.com/vindosVP/snauth/internal/models"
+)
+
+func (us *UserStorage) SaveRefreshToken(ctx context.Context, t *models.RefreshToken) error {
+	err := us.s.SaveRefreshToken(ctx, t)
+	if err != nil {
+		return errors.Wrap(err, "failed to save refresh token")
+	}
+	return nil
+}
+
+func (us *UserStorage) RefreshTokenByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	t, err := us.s.RefreshTokenByHash(ctx, tokenHash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrRefreshTokenNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find refresh token in db")
+	}
+	return t, nil
+}
+
+// UseRefreshToken marks the token as used. It fails with
+// ErrRefreshTokenAlreadyUsed if the token was used or revoked before.
+func (us *UserStorage) UseRefreshToken(ctx context.Context, id int64) error {
+	err := us.s.UseRefreshToken(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrRefreshTokenAlreadyUsed
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to mark refresh token as used")
+	}
+	return nil
+}
+
+func (us *UserStorage) RevokeRefreshTokenFamily(ctx context.Context, familyId string) error {
+	err := us.s.RevokeRefreshTokenFamily(ctx, familyId)
+	if err != nil {
+		return errors.Wrap(err, "failed to revoke refresh token family")
+	}
+	return nil
+}
+
+func (us *UserStorage) RefreshTokenFamilyActive(ctx context.Context, familyId string) (bool, error) {
+	active, err := us.s.RefreshTokenFamilyActive(ctx, familyId)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to check refresh token family")
+	}
+	return active, nil
+}
+
+func (us *UserStorage) RevokeUserRefreshTokens(ctx context.Context, userId int64) error {
+	err := us.s.RevokeUserRefreshTokens(ctx, userId)
+	if err != nil {
+		return errors.Wrap(err, "failed to revoke user refresh tokens")
+	}
+	return nil
+}
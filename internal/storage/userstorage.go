@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -17,6 +18,60 @@ type Storage interface {
 	SetDeletedToUser(ctx context.Context, userId int64, isDeleted bool) (bool, error)
 	SetBannedToUser(ctx context.Context, userId int64, isBanned bool) (bool, error)
 	SetAdminToUser(ctx context.Context, userId int64, isAdmin bool) (bool, error)
+	SetTokensValidAfter(ctx context.Context, userId int64, validAfter time.Time) error
+	UpdatePassword(ctx context.Context, userId int64, hPassword []byte) error
+	SetEmailVerified(ctx context.Context, userId int64, verifiedAt time.Time) error
+	ClaimAccount(ctx context.Context, userId int64, hPassword []byte, verifiedAt time.Time) error
+	ListUsers(ctx context.Context, filter models.UserFilter, page models.UserPage) ([]*models.User, error)
+	CountUsers(ctx context.Context, filter models.UserFilter) (int64, error)
+	SaveRefreshToken(ctx context.Context, t *models.RefreshToken) error
+	RefreshTokenByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error)
+	UseRefreshToken(ctx context.Context, id int64) error
+	RevokeRefreshTokenFamily(ctx context.Context, familyId string) error
+	RevokeUserRefreshTokens(ctx context.Context, userId int64) error
+	RefreshTokenFamilyActive(ctx context.Context, familyId string) (bool, error)
+	SaveOneTimeToken(ctx context.Context, t *models.OneTimeToken) error
+	OneTimeToken(ctx context.Context, purpose string, tokenHash string) (*models.OneTimeToken, error)
+	UseOneTimeToken(ctx context.Context, purpose string, tokenHash string) (*models.OneTimeToken, error)
+	InvalidateOneTimeTokens(ctx context.Context, userId int64, purpose string) error
+	LoginThrottle(ctx context.Context, key string) (*models.LoginThrottle, error)
+	RecordLoginFailure(ctx context.Context, key string, resetBefore time.Time) (*models.LoginThrottle, error)
+	LockLogin(ctx context.Context, key string, until time.Time) error
+	ResetLoginThrottle(ctx context.Context, key string) error
+	SaveAuditEvent(ctx context.Context, e *models.AuditEvent) error
+	ListAuditEvents(ctx context.Context, filter models.AuditFilter, beforeId int64, limit int) ([]*models.AuditEvent, error)
+	CreateRole(ctx context.Context, name string, permissions []string) (*models.Role, error)
+	RoleByName(ctx context.Context, name string) (*models.Role, error)
+	Roles(ctx context.Context) ([]*models.Role, error)
+	GrantPermission(ctx context.Context, roleId int64, permission string) error
+	RevokePermission(ctx context.Context, roleId int64, permission string) error
+	AssignRole(ctx context.Context, userId int64, roleId int64) error
+	UnassignRole(ctx context.Context, userId int64, roleId int64) error
+	UserAccess(ctx context.Context, userId int64) (*models.UserAccess, error)
+	SaveTOTP(ctx context.Context, userId int64, secret []byte) error
+	TOTP(ctx context.Context, userId int64) (*models.TOTP, error)
+	ConfirmTOTP(ctx context.Context, userId int64, counter int64, recoveryCodeHashes []string) error
+	UseTOTPCounter(ctx context.Context, userId int64, counter int64) error
+	UseRecoveryCode(ctx context.Context, userId int64, codeHash string) error
+	SaveWebAuthnCredential(ctx context.Context, c *models.WebAuthnCredential) error
+	WebAuthnCredential(ctx context.Context, credentialId []byte) (*models.WebAuthnCredential, error)
+	WebAuthnCredentials(ctx context.Context, userId int64) ([]*models.WebAuthnCredential, error)
+	UpdateWebAuthnCredentialUse(ctx context.Context, credentialId []byte, signCount uint32, backupState bool) error
+	SaveWebAuthnSession(ctx context.Context, ws *models.WebAuthnSession) error
+	UseWebAuthnSession(ctx context.Context, ceremony string, tokenHash string) (*models.WebAuthnSession, error)
+	CreateOAuthClient(ctx context.Context, c *models.OAuthClient) error
+	OAuthClient(ctx context.Context, clientId string) (*models.OAuthClient, error)
+	OAuthClients(ctx context.Context) ([]*models.OAuthClient, error)
+	DeleteOAuthClient(ctx context.Context, clientId string) error
+	SaveAuthorizationCode(ctx context.Context, c *models.AuthorizationCode) error
+	UseAuthorizationCode(ctx context.Context, codeHash string) (*models.AuthorizationCode, error)
+	CreateServiceAccount(ctx context.Context, a *models.ServiceAccount) error
+	ServiceAccount(ctx context.Context, clientId string) (*models.ServiceAccount, error)
+	ServiceAccounts(ctx context.Context) ([]*models.ServiceAccount, error)
+	RotateServiceAccountSecret(ctx context.Context, clientId string, secretHash string, rotatedAt time.Time) error
+	DisableServiceAccount(ctx context.Context, clientId string, disabledAt time.Time) error
+	SaveSigningKey(ctx context.Context, k *models.SigningKey) error
+	SigningKeys(ctx context.Context) ([]*models.SigningKey, error)
 }
 
 type UserStorage struct {
@@ -29,6 +84,9 @@ func NewUserStorage(s Storage) *UserStorage {
 
 func (us *UserStorage) SetDeletedToUser(ctx context.Context, userId int64, isDeleted bool) (bool, error) {
 	deleted, err := us.s.SetDeletedToUser(ctx, userId, isDeleted)
+	if errors.Is(err, ErrLastAdmin) {
+		return false, ErrLastAdmin
+	}
 	if err != nil {
 		return false, errors.Wrap(err, "failed to set deleted flag to user")
 	}
@@ -37,6 +95,9 @@ func (us *UserStorage) SetDeletedToUser(ctx context.Context, userId int64, isDel
 
 func (us *UserStorage) SetBannedToUser(ctx context.Context, userId int64, isBanned bool) (bool, error) {
 	banned, err := us.s.SetBannedToUser(ctx, userId, isBanned)
+	if errors.Is(err, ErrLastAdmin) {
+		return false, ErrLastAdmin
+	}
 	if err != nil {
 		return false, errors.Wrap(err, "failed to set banned flag to user")
 	}
@@ -45,12 +106,59 @@ func (us *UserStorage) SetBannedToUser(ctx context.Context, userId int64, isBann
 
 func (us *UserStorage) SetAdminToUser(ctx context.Context, userId int64, isAdmin bool) (bool, error) {
 	admin, err := us.s.SetAdminToUser(ctx, userId, isAdmin)
+	if errors.Is(err, ErrLastAdmin) {
+		return false, ErrLastAdmin
+	}
 	if err != nil {
 		return false, errors.Wrap(err, "failed to set admin flag to user")
 	}
 	return admin, nil
 }
 
+func (us *UserStorage) SetTokensValidAfter(ctx context.Context, userId int64, validAfter time.Time) error {
+	err := us.s.SetTokensValidAfter(ctx, userId, validAfter)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrUserDoesNotExist
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to set tokens valid after to user")
+	}
+	return nil
+}
+
+func (us *UserStorage) UpdatePassword(ctx context.Context, userId int64, hPassword []byte) error {
+	err := us.s.UpdatePassword(ctx, userId, hPassword)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrUserDoesNotExist
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to update user password")
+	}
+	return nil
+}
+
+func (us *UserStorage) ClaimAccount(ctx context.Context, userId int64, hPassword []byte, verifiedAt time.Time) error {
+	err := us.s.ClaimAccount(ctx, userId, hPassword, verifiedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrUserDoesNotExist
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to claim account")
+	}
+	return nil
+}
+
+func (us *UserStorage) SetEmailVerified(ctx context.Context, userId int64, verifiedAt time.Time) error {
+	err := us.s.SetEmailVerified(ctx, userId, verifiedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrUserDoesNotExist
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to set email verified to user")
+	}
+	return nil
+}
+
 func (us *UserStorage) CreateUser(ctx context.Context, email string, hPassword []byte) (int64, error) {
 	u, err := us.s.UserByEmail(ctx, email)
 	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
@@ -87,3 +195,19 @@ func (us *UserStorage) UserByID(ctx context.Context, id int64) (*models.User, er
 	}
 	return u, nil
 }
+
+func (us *UserStorage) ListUsers(ctx context.Context, filter models.UserFilter, page models.UserPage) ([]*models.User, error) {
+	users, err := us.s.ListUsers(ctx, filter, page)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list users in db")
+	}
+	return users, nil
+}
+
+func (us *UserStorage) CountUsers(ctx context.Context, filter models.UserFilter) (int64, error) {
+	count, err := us.s.CountUsers(ctx, filter)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to count users in db")
+	}
+	return count, nil
+}
@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+
+	"github.com/vindosVP/snauth/internal/models"
+)
+
+func (us *UserStorage) SaveWebAuthnCredential(ctx context.Context, c *models.WebAuthnCredential) error {
+	existing, err := us.s.WebAuthnCredential(ctx, c.CredentialId)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return errors.Wrap(err, "failed to get webauthn credential")
+	}
+	if existing != nil {
+		return ErrWebAuthnCredentialExists
+	}
+	err = us.s.SaveWebAuthnCredential(ctx, c)
+	if err != nil {
+		return errors.Wrap(err, "failed to save webauthn credential")
+	}
+	return nil
+}
+
+func (us *UserStorage) WebAuthnCredentials(ctx context.Context, userId int64) ([]*models.WebAuthnCredential, error) {
+	credentials, err := us.s.WebAuthnCredentials(ctx, userId)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get webauthn credentials")
+	}
+	return credentials, nil
+}
+
+func (us *UserStorage) UpdateWebAuthnCredentialUse(ctx context.Context, credentialId []byte, signCount uint32, backupState bool) error {
+	err := us.s.UpdateWebAuthnCredentialUse(ctx, credentialId, signCount, backupState)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrWebAuthnCredentialNotFound
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to update webauthn credential")
+	}
+	return nil
+}
+
+func (us *UserStorage) SaveWebAuthnSession(ctx context.Context, ws *models.WebAuthnSession) error {
+	err := us.s.SaveWebAuthnSession(ctx, ws)
+	if err != nil {
+		return errors.Wrap(err, "failed to save webauthn session")
+	}
+	return nil
+}
+
+// UseWebAuthnSession fails with ErrWebAuthnSessionInvalid if the session
+// does not exist, has expired or was used before.
+func (us *UserStorage) UseWebAuthnSession(ctx context.Context, ceremony string, tokenHash string) (*models.WebAuthnSession, error) {
+	ws, err := us.s.UseWebAuthnSession(ctx, ceremony, tokenHash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrWebAuthnSessionInvalid
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to use webauthn session")
+	}
+	return ws, nil
+}
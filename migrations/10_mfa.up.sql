@@ -0,0 +1,15 @@
+CREATE TABLE user_totp (
+    "user_id" INTEGER PRIMARY KEY NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    "secret" bytea NOT NULL,
+    "last_counter" BIGINT NOT NULL,
+    "created_at" timestamp NOT NULL,
+    "confirmed_at" timestamp
+);
+CREATE TABLE recovery_codes (
+    "id" BIGINT GENERATED BY DEFAULT AS IDENTITY UNIQUE PRIMARY KEY NOT NULL,
+    "user_id" INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    "code_hash" text NOT NULL,
+    "created_at" timestamp NOT NULL,
+    "used_at" timestamp
+);
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_user_id ON recovery_codes (user_id);
\ No newline at end of file
@@ -0,0 +1,24 @@
+CREATE TABLE webauthn_credentials (
+    "id" BIGINT GENERATED BY DEFAULT AS IDENTITY UNIQUE PRIMARY KEY NOT NULL,
+    "user_id" INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    "credential_id" bytea UNIQUE NOT NULL,
+    "name" text NOT NULL,
+    "public_key" bytea NOT NULL,
+    "attestation_type" text NOT NULL,
+    "transports" text[] NOT NULL,
+    "aaguid" bytea NOT NULL,
+    "sign_count" BIGINT NOT NULL,
+    "backup_eligible" boolean NOT NULL,
+    "backup_state" boolean NOT NULL,
+    "created_at" timestamp NOT NULL,
+    "last_used_at" timestamp
+);
+CREATE INDEX IF NOT EXISTS idx_webauthn_credentials_user_id ON webauthn_credentials (user_id);
+CREATE TABLE webauthn_sessions (
+    "id" BIGINT GENERATED BY DEFAULT AS IDENTITY UNIQUE PRIMARY KEY NOT NULL,
+    "user_id" INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    "ceremony" text NOT NULL,
+    "token_hash" text UNIQUE NOT NULL,
+    "data" jsonb NOT NULL,
+    "expires_at" timestamp NOT NULL
+);
\ No newline at end of file
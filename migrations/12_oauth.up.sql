@@ -0,0 +1,22 @@
+CREATE TABLE oauth_clients (
+    "id" BIGINT GENERATED BY DEFAULT AS IDENTITY UNIQUE PRIMARY KEY NOT NULL,
+    "client_id" text UNIQUE NOT NULL,
+    "name" text NOT NULL,
+    "secret_hash" text NOT NULL,
+    "redirect_uris" text[] NOT NULL,
+    "created_at" timestamp NOT NULL
+);
+CREATE TABLE authorization_codes (
+    "id" BIGINT GENERATED BY DEFAULT AS IDENTITY UNIQUE PRIMARY KEY NOT NULL,
+    "code_hash" text UNIQUE NOT NULL,
+    "client_id" text NOT NULL REFERENCES oauth_clients (client_id) ON DELETE CASCADE,
+    "user_id" INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    "redirect_uri" text NOT NULL,
+    "scope" text NOT NULL,
+    "nonce" text NOT NULL,
+    "code_challenge" text NOT NULL,
+    "auth_time" timestamp NOT NULL,
+    "created_at" timestamp NOT NULL,
+    "expires_at" timestamp NOT NULL,
+    "used_at" timestamp
+);
\ No newline at end of file
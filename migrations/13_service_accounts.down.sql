@@ -0,0 +1 @@
+DROP TABLE IF EXISTS service_accounts;
\ No newline at end of file
@@ -0,0 +1,10 @@
+CREATE TABLE service_accounts (
+    "id" BIGINT GENERATED BY DEFAULT AS IDENTITY UNIQUE PRIMARY KEY NOT NULL,
+    "client_id" text UNIQUE NOT NULL,
+    "name" text NOT NULL,
+    "secret_hash" text NOT NULL,
+    "scopes" text[] NOT NULL,
+    "created_at" timestamp NOT NULL,
+    "secret_rotated_at" timestamp,
+    "disabled_at" timestamp
+);
\ No newline at end of file
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_audit_events_actor_service_account;
+ALTER TABLE audit_events
+    DROP COLUMN actor_service_account;
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE audit_events
+    ADD COLUMN actor_service_account text;
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor_service_account ON audit_events (actor_service_account);
\ No newline at end of file
@@ -0,0 +1,4 @@
+ALTER TABLE refresh_tokens
+    DROP COLUMN client_id,
+    DROP COLUMN scope,
+    DROP COLUMN auth_time;
\ No newline at end of file
@@ -0,0 +1,4 @@
+ALTER TABLE refresh_tokens
+    ADD COLUMN client_id text REFERENCES oauth_clients (client_id) ON DELETE CASCADE,
+    ADD COLUMN scope text NOT NULL DEFAULT '',
+    ADD COLUMN auth_time timestamp;
\ No newline at end of file
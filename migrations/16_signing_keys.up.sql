@@ -0,0 +1,8 @@
+CREATE TABLE signing_keys (
+    "kid" text UNIQUE PRIMARY KEY NOT NULL,
+    "algorithm" text NOT NULL,
+    "private_key" bytea NOT NULL,
+    "created_at" timestamp NOT NULL,
+    "retired_at" timestamp
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_signing_keys_active ON signing_keys ((retired_at IS NULL)) WHERE retired_at IS NULL;
\ No newline at end of file
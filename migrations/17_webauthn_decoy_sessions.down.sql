@@ -0,0 +1,2 @@
+DELETE FROM webauthn_sessions WHERE user_id IS NULL;
+ALTER TABLE webauthn_sessions ALTER COLUMN user_id SET NOT NULL;
\ No newline at end of file
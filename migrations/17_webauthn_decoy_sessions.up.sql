@@ -0,0 +1 @@
+ALTER TABLE webauthn_sessions ALTER COLUMN user_id DROP NOT NULL;
\ No newline at end of file
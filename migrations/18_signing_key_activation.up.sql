@@ -0,0 +1,3 @@
+ALTER TABLE signing_keys ADD COLUMN activates_at timestamp;
+UPDATE signing_keys SET activates_at = created_at;
+ALTER TABLE signing_keys ALTER COLUMN activates_at SET NOT NULL;
\ No newline at end of file
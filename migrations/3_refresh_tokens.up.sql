@@ -0,0 +1,12 @@
+CREATE TABLE refresh_tokens (
+    "id" BIGINT GENERATED BY DEFAULT AS IDENTITY UNIQUE PRIMARY KEY NOT NULL,
+    "user_id" INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    "family_id" text NOT NULL,
+    "token_hash" text UNIQUE NOT NULL,
+    "created_at" timestamp NOT NULL,
+    "expires_at" timestamp NOT NULL,
+    "used_at" timestamp,
+    "revoked_at" timestamp
+);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens (family_id);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens (user_id);
\ No newline at end of file
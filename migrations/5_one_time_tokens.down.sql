@@ -0,0 +1 @@
+DROP TABLE IF EXISTS one_time_tokens CASCADE;
\ No newline at end of file
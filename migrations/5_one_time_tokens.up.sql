@@ -0,0 +1,10 @@
+CREATE TABLE one_time_tokens (
+    "id" BIGINT GENERATED BY DEFAULT AS IDENTITY UNIQUE PRIMARY KEY NOT NULL,
+    "user_id" INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    "purpose" text NOT NULL,
+    "token_hash" text UNIQUE NOT NULL,
+    "created_at" timestamp NOT NULL,
+    "expires_at" timestamp NOT NULL,
+    "used_at" timestamp
+);
+CREATE INDEX IF NOT EXISTS idx_one_time_tokens_user_id_purpose ON one_time_tokens (user_id, purpose);
\ No newline at end of file
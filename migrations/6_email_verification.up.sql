@@ -0,0 +1,2 @@
+ALTER TABLE users
+    ADD COLUMN email_verified_at timestamp;
\ No newline at end of file
@@ -0,0 +1,6 @@
+CREATE TABLE login_throttle (
+    "key" text PRIMARY KEY NOT NULL,
+    "failures" INTEGER NOT NULL,
+    "last_failure_at" timestamp NOT NULL,
+    "locked_until" timestamp
+);
\ No newline at end of file
@@ -0,0 +1,13 @@
+CREATE TABLE audit_events (
+    "id" BIGINT GENERATED BY DEFAULT AS IDENTITY UNIQUE PRIMARY KEY NOT NULL,
+    "type" text NOT NULL,
+    "actor_id" INTEGER,
+    "target_id" INTEGER,
+    "ip" text NOT NULL,
+    "request_id" text NOT NULL,
+    "details" text NOT NULL,
+    "created_at" timestamp NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor_id ON audit_events (actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_target_id ON audit_events (target_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events (created_at);
\ No newline at end of file
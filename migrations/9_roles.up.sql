@@ -0,0 +1,16 @@
+CREATE TABLE roles (
+    "id" INTEGER GENERATED BY DEFAULT AS IDENTITY UNIQUE PRIMARY KEY NOT NULL,
+    "name" text UNIQUE NOT NULL,
+    "created_at" timestamp NOT NULL
+);
+CREATE TABLE role_permissions (
+    "role_id" INTEGER NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    "permission" text NOT NULL,
+    PRIMARY KEY (role_id, permission)
+);
+CREATE TABLE user_roles (
+    "user_id" INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    "role_id" INTEGER NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    PRIMARY KEY (user_id, role_id)
+);
+CREATE INDEX IF NOT EXISTS idx_user_roles_role_id ON user_roles (role_id);
\ No newline at end of file